@@ -1,3 +1,15 @@
 module github.com/opiproject/opi-gateway-evpn-cni
 
 go 1.19
+
+require (
+	github.com/containernetworking/plugins v1.2.0
+	github.com/safchain/ethtool v0.3.0
+	github.com/vishvananda/netlink v1.3.0
+)
+
+require (
+	github.com/containernetworking/cni v1.1.2 // indirect
+	github.com/vishvananda/netns v0.0.4 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CleanCachedNetConfByContainer removes every scratch file of container cid
+// in dataDir, whatever interface it was written for, and returns the keys
+// of the removed files. No matching file is not an error.
+func CleanCachedNetConfByContainer(dataDir, cid string) ([]string, error) {
+	if cid == "" || strings.ContainsRune(cid, os.PathSeparator) {
+		return nil, fmt.Errorf("invalid container id %q", cid)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read data dir %q: %w", dataDir, err)
+	}
+
+	removed := []string{}
+	prefix := cid + "-"
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dataDir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to remove cached net conf %q: %w", entry.Name(), err)
+		}
+		removed = append(removed, entry.Name())
+	}
+	return removed, nil
+}
+
+// LockContainerRef takes an exclusive lock for the container ref cRefKey in
+// dataDir, serializing ADD and DEL handling of the same ref. The returned
+// function releases the lock and removes the lock file, so refs of deleted
+// containers leave nothing behind. Lock files live in a separate directory
+// so they are never mistaken for cached net confs.
+func LockContainerRef(dataDir, cRefKey string) (func(), error) {
+	if cRefKey == "" || strings.ContainsRune(cRefKey, os.PathSeparator) {
+		return nil, fmt.Errorf("invalid container ref %q", cRefKey)
+	}
+	return lockFile(filepath.Join(dataDir, ".locks", cRefKey+".lock"), true)
+}
+
+// PruneScratchNetConf removes the cached net confs in dataDir that were not
+// modified for longer than maxAge, a safety net for missed DELs, and
+// returns the removed keys. It does not check whether the owning containers
+// are still running, so maxAge should be well above any pod lifetime the
+// node is expected to see.
+func PruneScratchNetConf(dataDir string, maxAge time.Duration) ([]string, error) {
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("invalid max age %v", maxAge)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read data dir %q: %w", dataDir, err)
+	}
+
+	pruned := []string{}
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return pruned, fmt.Errorf("failed to stat cached net conf %q: %w", entry.Name(), err)
+		}
+		if !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dataDir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pruned, fmt.Errorf("failed to remove cached net conf %q: %w", entry.Name(), err)
+		}
+		pruned = append(pruned, entry.Name())
+	}
+	return pruned, nil
+}
+
+// EnsureDataDir creates dataDir if needed and checks that it is writable by
+// creating and removing a probe file, so a bad data dir is reported at
+// startup instead of on the first ADD
+func EnsureDataDir(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create data dir %q: %w", dataDir, err)
+	}
+
+	probe, err := os.CreateTemp(dataDir, ".probe")
+	if err != nil {
+		return fmt.Errorf("data dir %q is not writable: %w", dataDir, err)
+	}
+	probeName := probe.Name()
+	if err := probe.Close(); err != nil {
+		return fmt.Errorf("failed to close probe file %q: %w", probeName, err)
+	}
+	if err := os.Remove(probeName); err != nil {
+		return fmt.Errorf("failed to remove probe file %q: %w", probeName, err)
+	}
+	return nil
+}
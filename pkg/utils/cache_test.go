@@ -0,0 +1,335 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeCacheFiles creates an empty file in dir for each name
+func writeCacheFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0600); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+}
+
+// listDir returns the sorted names of the entries of dir
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read %q: %v", dir, err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestCleanCachedNetConfByContainer(t *testing.T) {
+	tests := map[string]struct {
+		files       []string
+		cid         string
+		wantRemoved []string
+		wantLeft    []string
+		wantErr     bool
+	}{
+		"several interfaces": {
+			files:       []string{"abc-net1", "abc-net2", "abc-eth0", "abcd-net1", "xyz-net1"},
+			cid:         "abc",
+			wantRemoved: []string{"abc-eth0", "abc-net1", "abc-net2"},
+			wantLeft:    []string{"abcd-net1", "xyz-net1"},
+		},
+		"no matching file": {
+			files:       []string{"xyz-net1"},
+			cid:         "abc",
+			wantRemoved: []string{},
+			wantLeft:    []string{"xyz-net1"},
+		},
+		"invalid container id": {
+			files:    []string{"abc-net1"},
+			cid:      "../abc",
+			wantErr:  true,
+			wantLeft: []string{"abc-net1"},
+		},
+		"empty container id": {
+			files:    []string{"-net1"},
+			wantErr:  true,
+			wantLeft: []string{"-net1"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			writeCacheFiles(t, dataDir, tt.files...)
+
+			removed, err := CleanCachedNetConfByContainer(dataDir, tt.cid)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("CleanCachedNetConfByContainer(%q) = %v, want error", tt.cid, removed)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("CleanCachedNetConfByContainer(%q) failed: %v", tt.cid, err)
+				}
+				sort.Strings(removed)
+				if !reflect.DeepEqual(removed, tt.wantRemoved) {
+					t.Errorf("CleanCachedNetConfByContainer(%q) = %v, want %v", tt.cid, removed, tt.wantRemoved)
+				}
+			}
+			if left := listDir(t, dataDir); !reflect.DeepEqual(left, tt.wantLeft) {
+				t.Errorf("files left = %v, want %v", left, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestCleanCachedNetConfByContainerMissingDir(t *testing.T) {
+	removed, err := CleanCachedNetConfByContainer(filepath.Join(t.TempDir(), "missing"), "abc")
+	if err != nil {
+		t.Fatalf("CleanCachedNetConfByContainer() failed: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("CleanCachedNetConfByContainer() = %v, want nothing removed", removed)
+	}
+}
+
+func TestLockContainerRef(t *testing.T) {
+	dataDir := t.TempDir()
+	lockDir := filepath.Join(dataDir, ".locks")
+
+	unlock, err := LockContainerRef(dataDir, "abc-net1")
+	if err != nil {
+		t.Fatalf("LockContainerRef() failed: %v", err)
+	}
+	if got, want := listDir(t, lockDir), []string{"abc-net1.lock"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lock files while locked = %v, want %v", got, want)
+	}
+	if got, want := listDir(t, dataDir), []string{".locks"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("data dir = %v, want only the lock directory %v", got, want)
+	}
+
+	unlock()
+	if got := listDir(t, lockDir); len(got) != 0 {
+		t.Errorf("lock files after unlock = %v, want none", got)
+	}
+
+	for _, ref := range []string{"", "../abc-net1", "abc/net1"} {
+		if _, err := LockContainerRef(dataDir, ref); err == nil {
+			t.Errorf("LockContainerRef(%q) succeeded, want error", ref)
+		}
+	}
+}
+
+func TestLockContainerRefConcurrent(t *testing.T) {
+	const rounds = 50
+	dataDir := t.TempDir()
+	cacheFile := filepath.Join(dataDir, "abc-net1")
+
+	var (
+		wg      sync.WaitGroup
+		holders int32
+		errs    = make(chan error, 2*rounds)
+	)
+	// a runtime retrying ADD while DEL is still running for the same ref
+	handle := func(add bool) {
+		defer wg.Done()
+		unlock, err := LockContainerRef(dataDir, "abc-net1")
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer unlock()
+
+		if n := atomic.AddInt32(&holders, 1); n != 1 {
+			errs <- fmt.Errorf("%d holders of the lock", n)
+		}
+		defer atomic.AddInt32(&holders, -1)
+
+		if add {
+			if err := os.WriteFile(cacheFile, []byte(`{"cniVersion":"1.0.0"}`), 0600); err != nil {
+				errs <- err
+			}
+			if data, err := os.ReadFile(cacheFile); err != nil || string(data) != `{"cniVersion":"1.0.0"}` {
+				errs <- fmt.Errorf("cache file read back as %q, %v", data, err)
+			}
+			return
+		}
+		if err := os.Remove(cacheFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs <- err
+		}
+	}
+
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go handle(true)
+		go handle(false)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := listDir(t, filepath.Join(dataDir, ".locks")); len(got) != 0 {
+		t.Errorf("lock files left behind: %v", got)
+	}
+}
+
+func TestPruneScratchNetConf(t *testing.T) {
+	now := time.Now()
+	files := map[string]time.Duration{
+		"abc-net1":    48 * time.Hour,
+		"abc-net2":    25 * time.Hour,
+		"def-net1":    time.Hour,
+		"ghi-net1":    0,
+		".probe":      48 * time.Hour,
+		".locks/x.lk": 48 * time.Hour,
+	}
+
+	tests := map[string]struct {
+		maxAge     time.Duration
+		wantPruned []string
+		wantLeft   []string
+		wantErr    bool
+	}{
+		"prune older than a day": {
+			maxAge:     24 * time.Hour,
+			wantPruned: []string{"abc-net1", "abc-net2"},
+			wantLeft:   []string{".locks", ".probe", "def-net1", "ghi-net1"},
+		},
+		"nothing old enough": {
+			maxAge:     72 * time.Hour,
+			wantPruned: []string{},
+			wantLeft:   []string{".locks", ".probe", "abc-net1", "abc-net2", "def-net1", "ghi-net1"},
+		},
+		"zero max age": {
+			wantErr:  true,
+			wantLeft: []string{".locks", ".probe", "abc-net1", "abc-net2", "def-net1", "ghi-net1"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			for file, age := range files {
+				path := filepath.Join(dataDir, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatalf("failed to create %q: %v", filepath.Dir(path), err)
+				}
+				writeCacheFiles(t, filepath.Dir(path), filepath.Base(path))
+				mtime := now.Add(-age)
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatalf("failed to set mtime of %q: %v", path, err)
+				}
+			}
+
+			pruned, err := PruneScratchNetConf(dataDir, tt.maxAge)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("PruneScratchNetConf(%v) = %v, want error", tt.maxAge, pruned)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("PruneScratchNetConf(%v) failed: %v", tt.maxAge, err)
+				}
+				sort.Strings(pruned)
+				if !reflect.DeepEqual(pruned, tt.wantPruned) {
+					t.Errorf("PruneScratchNetConf(%v) = %v, want %v", tt.maxAge, pruned, tt.wantPruned)
+				}
+			}
+			if got := listDir(t, dataDir); !reflect.DeepEqual(got, tt.wantLeft) {
+				t.Errorf("data dir after prune = %v, want %v", got, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestPruneScratchNetConfMissingDir(t *testing.T) {
+	pruned, err := PruneScratchNetConf(filepath.Join(t.TempDir(), "missing"), time.Hour)
+	if err != nil {
+		t.Fatalf("PruneScratchNetConf() failed: %v", err)
+	}
+	if len(pruned) != 0 {
+		t.Errorf("PruneScratchNetConf() = %v, want nothing pruned", pruned)
+	}
+}
+
+func TestEnsureDataDir(t *testing.T) {
+	tests := map[string]struct {
+		dataDir func(t *testing.T) string
+		wantErr bool
+	}{
+		"existing dir": {
+			dataDir: func(t *testing.T) string { return t.TempDir() },
+		},
+		"missing nested dir": {
+			dataDir: func(t *testing.T) string { return filepath.Join(t.TempDir(), "var", "lib", "cni") },
+		},
+		"parent is a file": {
+			dataDir: func(t *testing.T) string {
+				parent := filepath.Join(t.TempDir(), "file")
+				writeCacheFiles(t, filepath.Dir(parent), filepath.Base(parent))
+				return filepath.Join(parent, "cni")
+			},
+			wantErr: true,
+		},
+		"read-only dir": {
+			dataDir: func(t *testing.T) string {
+				if os.Geteuid() == 0 {
+					t.Skip("root ignores directory permissions")
+				}
+				dir := t.TempDir()
+				if err := os.Chmod(dir, 0500); err != nil {
+					t.Fatalf("failed to make %q read-only: %v", dir, err)
+				}
+				t.Cleanup(func() { _ = os.Chmod(dir, 0700) })
+				return dir
+			},
+			wantErr: true,
+		},
+		"read-only filesystem": {
+			// procfs refuses new files even for root
+			dataDir: func(t *testing.T) string { return "/proc" },
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dataDir := tt.dataDir(t)
+
+			err := EnsureDataDir(dataDir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("EnsureDataDir(%q) succeeded, want error", dataDir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EnsureDataDir(%q) failed: %v", dataDir, err)
+			}
+			if got := listDir(t, dataDir); len(got) != 0 {
+				t.Errorf("data dir %q = %v, want the probe file removed", dataDir, got)
+			}
+		})
+	}
+}
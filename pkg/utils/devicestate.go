@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// maxMTU is the largest MTU a netdev can be configured with
+const maxMTU = 65535
+
+// DeviceState is the state of a VF attachment needed to recreate it on
+// another node. IPs and sysctls are not part of it.
+type DeviceState struct {
+	PCIAddress string   `json:"pciAddress"`
+	PFName     string   `json:"pfName"`
+	VFID       int      `json:"vfId"`
+	VFConfig   VFConfig `json:"vfConfig"`
+	MAC        string   `json:"mac"`
+	MTU        int      `json:"mtu"`
+}
+
+// ExportDeviceState captures the state of the VF netdev ifName in the host
+// namespace: its PCI identity, the VF configuration set on its PF and the
+// MAC and MTU of the netdev
+func ExportDeviceState(ifName string) (DeviceState, error) {
+	pciAddr, err := netdevPciAddress(ifName)
+	if err != nil {
+		return DeviceState{}, err
+	}
+	pfName, err := GetPfName(pciAddr)
+	if err != nil {
+		return DeviceState{}, err
+	}
+	vfID, err := GetVfid(pciAddr, pfName)
+	if err != nil {
+		return DeviceState{}, err
+	}
+
+	cfg, err := SnapshotVFConfig(pfName, vfID)
+	if err != nil {
+		return DeviceState{}, err
+	}
+
+	link, err := netlinkOps.LinkByName(ifName)
+	if err != nil {
+		return DeviceState{}, fmt.Errorf("failed to lookup %q: %w", ifName, err)
+	}
+
+	return DeviceState{
+		PCIAddress: pciAddr,
+		PFName:     pfName,
+		VFID:       vfID,
+		VFConfig:   cfg,
+		MAC:        link.Attrs().HardwareAddr.String(),
+		MTU:        link.Attrs().MTU,
+	}, nil
+}
+
+// validate checks every field of state, returning the failures combined
+func (state DeviceState) validate() error {
+	var errs []error
+	if _, _, _, _, err := ParsePCIAddress(state.PCIAddress); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ValidateInterfaceName(state.PFName); err != nil {
+		errs = append(errs, fmt.Errorf("invalid PF name: %w", err))
+	}
+	if state.VFID < 0 {
+		errs = append(errs, fmt.Errorf("invalid VF ID %d", state.VFID))
+	}
+	if mac, err := net.ParseMAC(state.MAC); err != nil || !IsValidMACAddress(mac) {
+		errs = append(errs, fmt.Errorf("invalid MAC address %q", state.MAC))
+	}
+	if state.MTU <= 0 || state.MTU > maxMTU {
+		errs = append(errs, fmt.Errorf("invalid MTU %d", state.MTU))
+	}
+	return joinErrors(errs)
+}
+
+// ImportDeviceState applies state, exported from another VF, to the VF
+// netdev target in the host namespace. The VF configuration goes to the VF
+// backing target, whose PCI address, PF and VF ID may differ from the ones
+// recorded in state. Invalid fields are skipped, and every setting is
+// attempted with the failures returned combined.
+func ImportDeviceState(target string, state DeviceState) error {
+	vfID, pfName, err := GetVFIDFromNetdev(target)
+	if err != nil {
+		return err
+	}
+	link, err := netlinkOps.LinkByName(target)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %w", target, err)
+	}
+
+	var errs []error
+	if err := state.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ApplyVFConfig(pfName, vfID, state.VFConfig); err != nil {
+		errs = append(errs, err)
+	}
+	if mac, err := net.ParseMAC(state.MAC); err == nil && IsValidMACAddress(mac) {
+		if err := setNetdevMAC(link, mac); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set MAC %q on %q: %w", mac, target, err))
+		}
+	}
+	if state.MTU > 0 && state.MTU <= maxMTU {
+		if err := netlinkOps.LinkSetMTU(link, state.MTU); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set MTU %d on %q: %w", state.MTU, target, err))
+		}
+	}
+
+	if err := joinErrors(errs); err != nil {
+		return fmt.Errorf("failed to import device state to %q: %w", target, err)
+	}
+	return nil
+}
+
+// setNetdevMAC sets the MAC address of link, bringing it down for the change
+// and restoring its admin state afterwards
+func setNetdevMAC(link netlink.Link, mac net.HardwareAddr) error {
+	isUp := link.Attrs().Flags&net.FlagUp != 0
+	if isUp {
+		if err := netlinkOps.LinkSetDown(link); err != nil {
+			return err
+		}
+	}
+	setErr := netlinkOps.LinkSetHardwareAddr(link, mac)
+	if isUp {
+		if err := netlinkOps.LinkSetUp(link); err != nil && setErr == nil {
+			return err
+		}
+	}
+	return setErr
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// newDeviceStateNode returns the fake PFs and VF netdevs of newSriovSysfs:
+// VF 1 of enp59s0f0 configured and its netdev enp59s0f0v1 with a jumbo MTU,
+// and VF 0 of enp59s0f1 left at its defaults with the netdev enp59s0f1v0
+func newDeviceStateNode(t *testing.T) (*fakeNetlink, *netlink.Device, *netlink.Device) {
+	t.Helper()
+
+	f := newSriovSysfs(t)
+	f.addNetdev("enp59s0f1v0", "0000:3b:0a.0")
+
+	src := newFakePF("enp59s0f0", 3)
+	src.Vfs[1] = netlink.VfInfo{
+		ID:        1,
+		Mac:       net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01},
+		Vlan:      100,
+		Qos:       3,
+		VlanProto: int(netlink.VLAN_PROTOCOL_8021AD),
+		MinTxRate: 100,
+		MaxTxRate: 1000,
+		Trust:     1,
+		LinkState: netlink.VF_LINK_STATE_ENABLE,
+	}
+	srcNetdev := &netlink.Device{LinkAttrs: netlink.LinkAttrs{
+		Name:         "enp59s0f0v1",
+		HardwareAddr: net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01},
+		MTU:          9000,
+		Flags:        net.FlagUp,
+	}}
+	dst := newFakePF("enp59s0f1", 1)
+	dstNetdev := &netlink.Device{LinkAttrs: netlink.LinkAttrs{
+		Name:         "enp59s0f1v0",
+		HardwareAddr: net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55},
+		MTU:          1500,
+		Flags:        net.FlagUp,
+	}}
+	return newFakeNetlink(t, src, srcNetdev, dst, dstNetdev), src, dstNetdev
+}
+
+func TestDeviceStateRoundTrip(t *testing.T) {
+	nl, src, dstNetdev := newDeviceStateNode(t)
+
+	state, err := ExportDeviceState("enp59s0f0v1")
+	if err != nil {
+		t.Fatalf("ExportDeviceState() failed: %v", err)
+	}
+	want := DeviceState{
+		PCIAddress: "0000:3b:02.1",
+		PFName:     "enp59s0f0",
+		VFID:       1,
+		VFConfig: VFConfig{
+			MAC:       "02:aa:bb:cc:dd:01",
+			Vlan:      100,
+			Qos:       3,
+			VlanProto: int(netlink.VLAN_PROTOCOL_8021AD),
+			MinTxRate: 100,
+			MaxTxRate: 1000,
+			Trust:     true,
+			LinkState: netlink.VF_LINK_STATE_ENABLE,
+		},
+		MAC: "02:aa:bb:cc:dd:01",
+		MTU: 9000,
+	}
+	if state != want {
+		t.Fatalf("ExportDeviceState() = %+v, want %+v", state, want)
+	}
+
+	// the state travels to the other node serialized
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("failed to marshal %+v: %v", state, err)
+	}
+	var imported DeviceState
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", data, err)
+	}
+
+	if err := ImportDeviceState("enp59s0f1v0", imported); err != nil {
+		t.Fatalf("ImportDeviceState() failed: %v", err)
+	}
+	dstVF := nl.links["enp59s0f1"].Attrs().Vfs[0]
+	wantVF := src.Vfs[1]
+	wantVF.ID = 0
+	if !reflect.DeepEqual(dstVF, wantVF) {
+		t.Errorf("imported VF = %+v, want %+v", dstVF, wantVF)
+	}
+	if got := dstNetdev.HardwareAddr; !bytes.Equal(got, net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}) {
+		t.Errorf("netdev MAC = %v, want %s", got, want.MAC)
+	}
+	if dstNetdev.MTU != 9000 {
+		t.Errorf("netdev MTU = %d, want 9000", dstNetdev.MTU)
+	}
+	if dstNetdev.Flags&net.FlagUp == 0 {
+		t.Error("netdev left down after the MAC change")
+	}
+}
+
+func TestExportDeviceStateErrors(t *testing.T) {
+	nl, _, _ := newDeviceStateNode(t)
+
+	tests := map[string]struct {
+		ifName  string
+		wantErr error
+	}{
+		"PF netdev":      {ifName: "enp59s0f0", wantErr: ErrNotVF},
+		"missing netdev": {ifName: "enp59s0f0v9"},
+		"invalid name":   {ifName: "../enp59s0f0v1"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			state, err := ExportDeviceState(tt.ifName)
+			if err == nil {
+				t.Fatalf("ExportDeviceState(%q) = %+v, want error", tt.ifName, state)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExportDeviceState(%q) error = %v, want %v", tt.ifName, err, tt.wantErr)
+			}
+		})
+	}
+
+	// the netdev disappeared between the sysfs and the netlink lookups
+	delete(nl.links, "enp59s0f0v1")
+	if _, err := ExportDeviceState("enp59s0f0v1"); err == nil {
+		t.Error("ExportDeviceState() succeeded without the netdev link, want error")
+	}
+}
+
+func TestImportDeviceStateBestEffort(t *testing.T) {
+	state := DeviceState{
+		PCIAddress: "0000:3b:02.1",
+		PFName:     "enp59s0f0",
+		VFID:       1,
+		VFConfig:   VFConfig{MAC: "02:aa:bb:cc:dd:01", Vlan: 100, SpoofChk: true},
+		MAC:        "02:aa:bb:cc:dd:01",
+		MTU:        9000,
+	}
+
+	tests := map[string]struct {
+		modify  func(state *DeviceState)
+		errs    map[string]error
+		wantMAC net.HardwareAddr
+		wantMTU int
+		wantIs  error
+	}{
+		"MTU not applied": {
+			errs:    map[string]error{"LinkSetMTU": syscall.EINVAL},
+			wantMAC: net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01},
+			wantMTU: 1500,
+			wantIs:  syscall.EINVAL,
+		},
+		"MAC not applied": {
+			errs:    map[string]error{"LinkSetHardwareAddr": syscall.EADDRNOTAVAIL},
+			wantMAC: net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55},
+			wantMTU: 9000,
+			wantIs:  syscall.EADDRNOTAVAIL,
+		},
+		"invalid fields skipped": {
+			modify: func(state *DeviceState) {
+				state.PCIAddress = "3b:02.1"
+				state.MAC = "01:00:5e:00:00:01"
+				state.MTU = 0
+			},
+			wantMAC: net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55},
+			wantMTU: 1500,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			nl, _, dstNetdev := newDeviceStateNode(t)
+			for method, err := range tt.errs {
+				nl.errs[method] = err
+			}
+			state := state
+			if tt.modify != nil {
+				tt.modify(&state)
+			}
+
+			err := ImportDeviceState("enp59s0f1v0", state)
+			if err == nil {
+				t.Fatal("ImportDeviceState() succeeded, want error")
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("ImportDeviceState() error = %v, want %v", err, tt.wantIs)
+			}
+			// the VF configuration is applied regardless
+			if vf := nl.links["enp59s0f1"].Attrs().Vfs[0]; vf.Vlan != 100 || vf.Mac.String() != "02:aa:bb:cc:dd:01" {
+				t.Errorf("imported VF = %+v, want the VF configuration applied", vf)
+			}
+			if !bytes.Equal(dstNetdev.HardwareAddr, tt.wantMAC) {
+				t.Errorf("netdev MAC = %v, want %v", dstNetdev.HardwareAddr, tt.wantMAC)
+			}
+			if dstNetdev.MTU != tt.wantMTU {
+				t.Errorf("netdev MTU = %d, want %d", dstNetdev.MTU, tt.wantMTU)
+			}
+		})
+	}
+}
+
+func TestImportDeviceStateMissingTarget(t *testing.T) {
+	newDeviceStateNode(t)
+
+	state := DeviceState{PCIAddress: "0000:3b:02.1", PFName: "enp59s0f0", VFID: 1, MAC: "02:aa:bb:cc:dd:01", MTU: 1500}
+	for _, target := range []string{"enp59s0f1v9", "enp59s0f1", "../enp59s0f1v0"} {
+		if err := ImportDeviceState(target, state); err == nil {
+			t.Errorf("ImportDeviceState(%q) succeeded, want error", target)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/safchain/ethtool"
+)
+
+// ErrEthtoolStatsUnsupported is returned when the driver of an interface does
+// not expose ethtool statistics
+var ErrEthtoolStatsUnsupported = errors.New("driver does not support ethtool statistics")
+
+// ethtoolStats reads the driver statistics of an interface, a variable so
+// tests can stand in for the ioctl
+var ethtoolStats = ethtool.Stats
+
+// GetEthtoolStats returns the driver statistics of ifName, the equivalent
+// of "ethtool -S", including the vendor specific drop counters
+func GetEthtoolStats(ifName string) (map[string]uint64, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return nil, err
+	}
+
+	stats, err := ethtoolStats(ifName)
+	if err != nil {
+		if errors.Is(err, syscall.EOPNOTSUPP) {
+			return nil, fmt.Errorf("failed to get ethtool stats of %q: %w", ifName, ErrEthtoolStatsUnsupported)
+		}
+		return nil, fmt.Errorf("failed to get ethtool stats of %q: %w", ifName, err)
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("failed to get ethtool stats of %q: %w", ifName, ErrEthtoolStatsUnsupported)
+	}
+	return stats, nil
+}
+
+// SOF_TIMESTAMPING_* capability bits as defined in linux/net_tstamp.h
+const (
+	sofTimestampingTxHardware = 1 << 0
+	sofTimestampingRxHardware = 1 << 2
+)
+
+// hasHwTimestamping reports whether a SOF_TIMESTAMPING_* capability mask
+// includes both hardware tx and rx timestamping
+func hasHwTimestamping(soTimestamping uint32) bool {
+	required := uint32(sofTimestampingTxHardware | sofTimestampingRxHardware)
+	return soTimestamping&required == required
+}
+
+// SupportsHwTimestamp reports whether ifName supports hardware rx and tx
+// timestamping. Devices without timestamping support report false.
+func SupportsHwTimestamp(ifName string) (bool, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return false, err
+	}
+
+	e, err := ethtool.NewEthtool()
+	if err != nil {
+		return false, fmt.Errorf("failed to open ethtool socket: %w", err)
+	}
+	defer e.Close()
+
+	tsInfo, err := e.GetTimestampingInformation(ifName)
+	if err != nil {
+		if errors.Is(err, syscall.EOPNOTSUPP) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get timestamping information of %q: %w", ifName, err)
+	}
+	return hasHwTimestamping(tsInfo.SoTimestamping), nil
+}
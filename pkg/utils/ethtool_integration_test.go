@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+//go:build integration
+
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+func TestGetEthtoolStatsVeth(t *testing.T) {
+	netns := newTestNetns(t)
+	addTestLink(t, netns, "evpntest0")
+
+	err := netns.Do(func(ns.NetNS) error {
+		stats, err := GetEthtoolStats("evpntest0")
+		if err != nil {
+			return err
+		}
+		// veth reports the index of its peer as a driver stat
+		if _, ok := stats["peer_ifindex"]; !ok {
+			t.Errorf("GetEthtoolStats() = %v, want the veth peer_ifindex stat", stats)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetEthtoolStats() failed: %v", err)
+	}
+}
+
+func TestGetEthtoolStatsUnsupported(t *testing.T) {
+	netns := newTestNetns(t)
+
+	// loopback has no driver statistics
+	err := netns.Do(func(ns.NetNS) error {
+		_, err := GetEthtoolStats("lo")
+		return err
+	})
+	if !errors.Is(err, ErrEthtoolStatsUnsupported) {
+		t.Errorf("GetEthtoolStats(lo) error = %v, want %v", err, ErrEthtoolStatsUnsupported)
+	}
+}
+
+func TestSupportsHwTimestamp(t *testing.T) {
+	netns := newTestNetns(t)
+	addTestLink(t, netns, "evpntest0")
+
+	tests := map[string]struct {
+		ifName  string
+		wantErr bool
+	}{
+		// veth and loopback only timestamp in software
+		"veth":              {ifName: "evpntest0"},
+		"loopback":          {ifName: "lo"},
+		"missing interface": {ifName: "evpntest9", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got bool
+			err := netns.Do(func(ns.NetNS) error {
+				var err error
+				got, err = SupportsHwTimestamp(tt.ifName)
+				return err
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SupportsHwTimestamp(%q) = %v, want error", tt.ifName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SupportsHwTimestamp(%q) failed: %v", tt.ifName, err)
+			}
+			if got {
+				t.Errorf("SupportsHwTimestamp(%q) = true, want false for a software only device", tt.ifName)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestGetEthtoolStats(t *testing.T) {
+	tests := map[string]struct {
+		ifName  string
+		stats   map[string]uint64
+		err     error
+		want    map[string]uint64
+		wantErr error
+	}{
+		"driver stats": {
+			ifName: "enp59s0f0",
+			stats:  map[string]uint64{"rx_packets": 10, "rx_dropped_no_buffer": 2, "tx_queue_0_drops": 1},
+			want:   map[string]uint64{"rx_packets": 10, "rx_dropped_no_buffer": 2, "tx_queue_0_drops": 1},
+		},
+		"driver without stats": {ifName: "dummy0", stats: map[string]uint64{}, wantErr: ErrEthtoolStatsUnsupported},
+		"ioctl not supported":  {ifName: "dummy0", err: syscall.EOPNOTSUPP, wantErr: ErrEthtoolStatsUnsupported},
+		"missing interface":    {ifName: "enp59s0f9", err: syscall.ENODEV, wantErr: syscall.ENODEV},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			saved := ethtoolStats
+			t.Cleanup(func() { ethtoolStats = saved })
+			ethtoolStats = func(ifName string) (map[string]uint64, error) {
+				if ifName != tt.ifName {
+					t.Errorf("stats requested for %q, want %q", ifName, tt.ifName)
+				}
+				return tt.stats, tt.err
+			}
+
+			got, err := GetEthtoolStats(tt.ifName)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetEthtoolStats(%q) error = %v, want %v", tt.ifName, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetEthtoolStats(%q) failed: %v", tt.ifName, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetEthtoolStats(%q) = %v, want %v", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEthtoolStatsInvalidName(t *testing.T) {
+	saved := ethtoolStats
+	t.Cleanup(func() { ethtoolStats = saved })
+	ethtoolStats = func(string) (map[string]uint64, error) {
+		t.Error("ethtool queried for an invalid interface name")
+		return nil, nil
+	}
+
+	if _, err := GetEthtoolStats("../eth0"); err == nil {
+		t.Error("GetEthtoolStats() succeeded for an invalid name, want error")
+	}
+}
+
+func TestHasHwTimestamping(t *testing.T) {
+	// further SOF_TIMESTAMPING_* bits of linux/net_tstamp.h
+	const (
+		txSoftware  = 1 << 1
+		rxSoftware  = 1 << 3
+		software    = 1 << 4
+		rawHardware = 1 << 6
+	)
+
+	tests := map[string]struct {
+		soTimestamping uint32
+		want           bool
+	}{
+		"hardware rx and tx": {
+			soTimestamping: sofTimestampingTxHardware | sofTimestampingRxHardware | rawHardware,
+			want:           true,
+		},
+		"hardware and software": {
+			soTimestamping: sofTimestampingTxHardware | txSoftware | sofTimestampingRxHardware | rxSoftware | software | rawHardware,
+			want:           true,
+		},
+		"software only":    {soTimestamping: txSoftware | rxSoftware | software},
+		"hardware rx only": {soTimestamping: sofTimestampingRxHardware | rawHardware},
+		"hardware tx only": {soTimestamping: sofTimestampingTxHardware | rawHardware},
+		"no timestamping":  {soTimestamping: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := hasHwTimestamping(tt.soTimestamping); got != tt.want {
+				t.Errorf("hasHwTimestamping(%#x) = %v, want %v", tt.soTimestamping, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportsHwTimestampInvalidName(t *testing.T) {
+	if _, err := SupportsHwTimestamp("../eth0"); err == nil {
+		t.Error("SupportsHwTimestamp() succeeded for an invalid name, want error")
+	}
+}
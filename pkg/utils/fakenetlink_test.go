@@ -0,0 +1,247 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// linkNotFoundError stands in for netlink.LinkNotFoundError, which can not
+// be built outside of the netlink package
+type linkNotFoundError struct {
+	name string
+}
+
+func (e linkNotFoundError) Error() string {
+	return fmt.Sprintf("Link %s not found", e.name)
+}
+
+func (e linkNotFoundError) As(target interface{}) bool {
+	_, ok := target.(*netlink.LinkNotFoundError)
+	return ok
+}
+
+// fakeNetlink is an in-memory netlinkManager. VF changes are applied to the
+// VfInfo of the fake links so they can be checked afterwards.
+type fakeNetlink struct {
+	links map[string]netlink.Link
+	// errs makes the method of the given name fail with the error
+	errs map[string]error
+}
+
+// newFakeNetlink installs a fake netlinkManager holding links for the
+// duration of the test
+func newFakeNetlink(t *testing.T, links ...netlink.Link) *fakeNetlink {
+	t.Helper()
+
+	saved := netlinkOps
+	t.Cleanup(func() { netlinkOps = saved })
+
+	f := &fakeNetlink{links: map[string]netlink.Link{}, errs: map[string]error{}}
+	for _, link := range links {
+		f.links[link.Attrs().Name] = link
+	}
+	netlinkOps = f
+	return f
+}
+
+// newFakePF returns a PF link with numVfs VFs, spoof checking enabled on
+// all of them as most drivers default to
+func newFakePF(name string, numVfs int) *netlink.Device {
+	pf := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name}}
+	for vfID := 0; vfID < numVfs; vfID++ {
+		pf.Vfs = append(pf.Vfs, netlink.VfInfo{ID: vfID, Spoofchk: true})
+	}
+	return pf
+}
+
+// vf returns the VF info of VF vfID of link
+func (f *fakeNetlink) vf(link netlink.Link, vfID int) (*netlink.VfInfo, error) {
+	for i := range link.Attrs().Vfs {
+		if link.Attrs().Vfs[i].ID == vfID {
+			return &link.Attrs().Vfs[i], nil
+		}
+	}
+	return nil, syscall.EINVAL
+}
+
+func (f *fakeNetlink) LinkByName(name string) (netlink.Link, error) {
+	if err := f.errs["LinkByName"]; err != nil {
+		return nil, err
+	}
+	link, ok := f.links[name]
+	if !ok {
+		return nil, linkNotFoundError{name: name}
+	}
+	return link, nil
+}
+
+func (f *fakeNetlink) LinkList() ([]netlink.Link, error) {
+	if err := f.errs["LinkList"]; err != nil {
+		return nil, err
+	}
+	links := make([]netlink.Link, 0, len(f.links))
+	for _, link := range f.links {
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (f *fakeNetlink) LinkSetUp(link netlink.Link) error {
+	if err := f.errs["LinkSetUp"]; err != nil {
+		return err
+	}
+	link.Attrs().Flags |= net.FlagUp
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetDown(link netlink.Link) error {
+	if err := f.errs["LinkSetDown"]; err != nil {
+		return err
+	}
+	link.Attrs().Flags &^= net.FlagUp
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetName(link netlink.Link, name string) error {
+	if err := f.errs["LinkSetName"]; err != nil {
+		return err
+	}
+	if _, exists := f.links[name]; exists {
+		return syscall.EEXIST
+	}
+	if link.Attrs().Flags&net.FlagUp != 0 {
+		return syscall.EBUSY
+	}
+	delete(f.links, link.Attrs().Name)
+	link.Attrs().Name = name
+	f.links[name] = link
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	if err := f.errs["LinkSetHardwareAddr"]; err != nil {
+		return err
+	}
+	link.Attrs().HardwareAddr = hwaddr
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetMTU(link netlink.Link, mtu int) error {
+	if err := f.errs["LinkSetMTU"]; err != nil {
+		return err
+	}
+	link.Attrs().MTU = mtu
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfHardwareAddr(link netlink.Link, vfID int, hwaddr net.HardwareAddr) error {
+	if err := f.errs["LinkSetVfHardwareAddr"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.Mac = hwaddr
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfVlanQos(link netlink.Link, vfID, vlan, qos int) error {
+	if err := f.errs["LinkSetVfVlanQos"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.Vlan = vlan
+	vf.Qos = qos
+	vf.VlanProto = int(netlink.VLAN_PROTOCOL_8021Q)
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfVlanQosProto(link netlink.Link, vfID, vlan, qos, proto int) error {
+	if err := f.errs["LinkSetVfVlanQosProto"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.Vlan = vlan
+	vf.Qos = qos
+	vf.VlanProto = proto
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfRate(link netlink.Link, vfID, minRate, maxRate int) error {
+	if err := f.errs["LinkSetVfRate"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.MinTxRate = uint32(minRate)
+	vf.MaxTxRate = uint32(maxRate)
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfTxRate(link netlink.Link, vfID, rate int) error {
+	if err := f.errs["LinkSetVfTxRate"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.TxRate = rate
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfSpoofchk(link netlink.Link, vfID int, check bool) error {
+	if err := f.errs["LinkSetVfSpoofchk"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.Spoofchk = check
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfTrust(link netlink.Link, vfID int, state bool) error {
+	if err := f.errs["LinkSetVfTrust"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.Trust = 0
+	if state {
+		vf.Trust = 1
+	}
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetVfState(link netlink.Link, vfID int, state uint32) error {
+	if err := f.errs["LinkSetVfState"]; err != nil {
+		return err
+	}
+	vf, err := f.vf(link, vfID)
+	if err != nil {
+		return err
+	}
+	vf.LinkState = state
+	return nil
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeSysfs is a sysfs/procfs tree built in a temporary directory. The
+// package path globals point into it for the duration of the test.
+type fakeSysfs struct {
+	t    testing.TB
+	root string
+}
+
+// newFakeSysfs creates an empty fake tree and redirects the path globals to
+// it, restoring them when the test ends
+func newFakeSysfs(t testing.TB) *fakeSysfs {
+	t.Helper()
+
+	saved := EffectiveConfig()
+	t.Cleanup(func() {
+		NetDirectory = saved.NetDirectory
+		SysBusPci = saved.SysBusPci
+		SysKernelIommuGroups = saved.SysKernelIommuGroups
+		ProcIrq = saved.ProcIrq
+		HostNetns = saved.HostNetns
+		ProcKernelOsRelease = saved.ProcKernelOsRelease
+	})
+
+	f := &fakeSysfs{t: t, root: t.TempDir()}
+	NetDirectory = f.path("sys", "class", "net")
+	SysBusPci = f.path("sys", "bus", "pci", "devices")
+	SysKernelIommuGroups = f.path("sys", "kernel", "iommu_groups")
+	ProcIrq = f.path("proc", "irq")
+	ProcKernelOsRelease = f.path("proc", "sys", "kernel", "osrelease")
+
+	f.mkdir(NetDirectory)
+	f.mkdir(SysBusPci)
+	f.mkdir(ProcIrq)
+	return f
+}
+
+// path returns the absolute path of elem inside the fake tree
+func (f *fakeSysfs) path(elem ...string) string {
+	return filepath.Join(append([]string{f.root}, elem...)...)
+}
+
+// mkdir creates dir and its parents
+func (f *fakeSysfs) mkdir(dir string) {
+	f.t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		f.t.Fatalf("failed to create %q: %v", dir, err)
+	}
+}
+
+// writeFile writes content to path, creating its parent directories
+func (f *fakeSysfs) writeFile(path, content string) {
+	f.t.Helper()
+	f.mkdir(filepath.Dir(path))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		f.t.Fatalf("failed to write %q: %v", path, err)
+	}
+}
+
+// remove deletes path and everything below it
+func (f *fakeSysfs) remove(path string) {
+	f.t.Helper()
+	if err := os.RemoveAll(path); err != nil {
+		f.t.Fatalf("failed to remove %q: %v", path, err)
+	}
+}
+
+// symlink creates link pointing to target, replacing any existing link
+func (f *fakeSysfs) symlink(target, link string) {
+	f.t.Helper()
+	f.mkdir(filepath.Dir(link))
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		f.t.Fatalf("failed to remove %q: %v", link, err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		f.t.Fatalf("failed to link %q to %q: %v", link, target, err)
+	}
+}
+
+// addPciDevice creates the directory of the PCI device pciAddr along with
+// the given attribute files and returns it
+func (f *fakeSysfs) addPciDevice(pciAddr string, attrs map[string]string) string {
+	f.t.Helper()
+	devDir := filepath.Join(SysBusPci, pciAddr)
+	f.mkdir(devDir)
+	for name, value := range attrs {
+		f.writeFile(filepath.Join(devDir, name), value)
+	}
+	return devDir
+}
+
+// addNetdev creates the netdev ifName. When pciAddr is set the netdev is
+// backed by that PCI device, which is created if needed.
+func (f *fakeSysfs) addNetdev(ifName, pciAddr string) string {
+	f.t.Helper()
+	ifDir := filepath.Join(NetDirectory, ifName)
+	f.mkdir(ifDir)
+	if pciAddr != "" {
+		devDir := f.addPciDevice(pciAddr, nil)
+		f.mkdir(filepath.Join(devDir, "net", ifName))
+		f.symlink(devDir, filepath.Join(ifDir, "device"))
+	}
+	return ifDir
+}
+
+// addPF creates the SR-IOV PF netdev pfName at pfPci with the given VFs
+// enabled, VF i being at vfPcis[i]
+func (f *fakeSysfs) addPF(pfName, pfPci string, vfPcis ...string) {
+	f.t.Helper()
+	f.addNetdev(pfName, pfPci)
+	f.addPciDevice(pfPci, map[string]string{
+		"sriov_totalvfs": "64\n",
+		"sriov_numvfs":   strconv.Itoa(len(vfPcis)) + "\n",
+	})
+	for vfID, vfPci := range vfPcis {
+		f.addVF(pfPci, vfID, vfPci)
+	}
+}
+
+// addVF creates the VF device vfPci as VF vfID of the PF device pfPci
+func (f *fakeSysfs) addVF(pfPci string, vfID int, vfPci string) {
+	f.t.Helper()
+	pfDir := f.addPciDevice(pfPci, nil)
+	vfDir := f.addPciDevice(vfPci, nil)
+	f.symlink(vfDir, filepath.Join(pfDir, fmt.Sprintf("virtfn%d", vfID)))
+	f.symlink(pfDir, filepath.Join(vfDir, "physfn"))
+}
+
+// bindDriver binds the PCI device pciAddr to driver, an empty driver
+// unbinding it
+func (f *fakeSysfs) bindDriver(pciAddr, driver string) {
+	f.t.Helper()
+	link := filepath.Join(SysBusPci, pciAddr, "driver")
+	if driver == "" {
+		f.remove(link)
+		return
+	}
+	driverDir := filepath.Join(filepath.Dir(SysBusPci), "drivers", driver)
+	f.mkdir(driverDir)
+	f.symlink(driverDir, link)
+}
+
+// addIommuGroup puts the PCI device pciAddr into the iommu group group
+func (f *fakeSysfs) addIommuGroup(pciAddr string, group int) {
+	f.t.Helper()
+	groupDir := filepath.Join(SysKernelIommuGroups, strconv.Itoa(group))
+	devDir := f.addPciDevice(pciAddr, nil)
+	f.symlink(groupDir, filepath.Join(devDir, "iommu_group"))
+	f.symlink(devDir, filepath.Join(groupDir, "devices", pciAddr))
+}
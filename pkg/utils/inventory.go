@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+)
+
+// ErrNoFreeVF is returned when every VF of a PF is in use
+var ErrNoFreeVF = errors.New("no free VF")
+
+// VFInfo describes a VF of an SR-IOV PF as seen from the host
+type VFInfo struct {
+	PFName     string   `json:"pfName"`
+	VFID       int      `json:"vfId"`
+	PCIAddress string   `json:"pciAddress"`
+	Driver     string   `json:"driver"`
+	NetDevs    []string `json:"netDevs"`
+}
+
+// readVFInfo returns the host view of VF vfID of the PF pfName
+func readVFInfo(pfName string, vfID int) (VFInfo, error) {
+	pciAddr, err := GetPciAddress(pfName, vfID)
+	if err != nil {
+		return VFInfo{}, err
+	}
+
+	driver, err := GetDriverName(pciAddr)
+	if err != nil {
+		return VFInfo{}, err
+	}
+
+	netDevs, err := GetHostNetDevFromPci(pciAddr)
+	if err != nil {
+		return VFInfo{}, err
+	}
+
+	return VFInfo{
+		PFName:     pfName,
+		VFID:       vfID,
+		PCIAddress: pciAddr,
+		Driver:     driver,
+		NetDevs:    netDevs,
+	}, nil
+}
+
+// ListVFs returns the VFs configured on the PF pfName, ordered by VF ID. The
+// VFs are read concurrently, see SysfsConcurrency.
+func ListVFs(pfName string) ([]VFInfo, error) {
+	return listVFs(context.Background(), pfName)
+}
+
+// listVFs is ListVFs giving up once ctx is done
+func listVFs(ctx context.Context, pfName string) ([]VFInfo, error) {
+	numVfs, err := GetSriovNumVfs(pfName)
+	if err != nil {
+		return nil, err
+	}
+
+	vfs := make([]VFInfo, numVfs)
+	errs := make([]error, numVfs)
+	forEachConcurrently(ctx, numVfs, func(vfID int) {
+		vfs[vfID], errs[vfID] = readVFInfo(pfName, vfID)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vfs, nil
+}
+
+// GetFreeVF returns the ID and PCI address of the first VF of pfName that is
+// not in use: its netdev is still in the host namespace, i.e. it was not
+// moved into a container, and it is not bound to a userspace driver.
+// ErrNoFreeVF is returned when all VFs are taken.
+func GetFreeVF(pfName string) (vfID int, pci string, err error) {
+	vfs, err := ListVFs(pfName)
+	if err != nil {
+		return -1, "", err
+	}
+
+	for _, vf := range vfs {
+		if len(vf.NetDevs) > 0 && !isUserspaceDriver(vf.Driver) {
+			return vf.VFID, vf.PCIAddress, nil
+		}
+	}
+	return -1, "", fmt.Errorf("PF %q: %w", pfName, ErrNoFreeVF)
+}
+
+// isVFInUse reports whether vf is taken by a workload: its netdev left the
+// host namespace or it is bound to a userspace driver. Unbound VFs are not in
+// use.
+func isVFInUse(vf VFInfo) bool {
+	if isUserspaceDriver(vf.Driver) {
+		return true
+	}
+	return vf.Driver != "" && len(vf.NetDevs) == 0
+}
+
+// ListMovedOutVFs returns the VFs of pfName that were moved into a
+// container: bound to a kernel driver, not a userspace one, yet without a
+// netdev in the host namespace. Unbound VFs are not reported.
+func ListMovedOutVFs(pfName string) ([]VFInfo, error) {
+	vfs, err := ListVFs(pfName)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := []VFInfo{}
+	for _, vf := range vfs {
+		if len(vf.NetDevs) == 0 && vf.Driver != "" && !isUserspaceDriver(vf.Driver) {
+			moved = append(moved, vf)
+		}
+	}
+	return moved, nil
+}
+
+// ListSriovCapablePFs returns the SR-IOV capable PF netdevs of the host,
+// sorted by name
+func ListSriovCapablePFs() ([]string, error) {
+	return ListSriovCapablePFsContext(context.Background())
+}
+
+// ListSriovCapablePFsContext is ListSriovCapablePFs giving up with the
+// context error once ctx is done, so a slow sysfs can not hang the caller
+func ListSriovCapablePFsContext(ctx context.Context) ([]string, error) {
+	links, err := netlinkOps.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	pfs := []string{}
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pfName := link.Attrs().Name
+		capable, err := SupportsSriov(pfName)
+		if err != nil {
+			// the link was removed or renamed since the dump
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if capable {
+			pfs = append(pfs, pfName)
+		}
+	}
+	sort.Strings(pfs)
+	return pfs, nil
+}
+
+// ListAllVFs returns the VFs of every SR-IOV capable PF of the host, ordered
+// by PF name and VF ID. A PF whose VFs can not be read does not stop the
+// others: the VFs found are returned along with the combined failures.
+func ListAllVFs() ([]VFInfo, error) {
+	return ListAllVFsContext(context.Background())
+}
+
+// ListAllVFsContext is ListAllVFs giving up once ctx is done. The VFs of the
+// PFs walked so far are returned along with the context error.
+func ListAllVFsContext(ctx context.Context) ([]VFInfo, error) {
+	pfs, err := ListSriovCapablePFsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vfs := []VFInfo{}
+	var errs []error
+	for _, pfName := range pfs {
+		pfVfs, err := listVFs(ctx, pfName)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return vfs, joinErrors(append(errs, ctxErr))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list VFs of PF %q: %w", pfName, err))
+			continue
+		}
+		vfs = append(vfs, pfVfs...)
+	}
+	return vfs, joinErrors(errs)
+}
+
+// PFInfo describes an SR-IOV PF and its VFs as seen from the host
+type PFInfo struct {
+	Name       string   `json:"name"`
+	PCIAddress string   `json:"pciAddress"`
+	Driver     string   `json:"driver"`
+	TotalVFs   int      `json:"totalVfs"`
+	NumVFs     int      `json:"numVfs"`
+	VFs        []VFInfo `json:"vfs"`
+}
+
+// GetPFInfo returns the host view of the SR-IOV PF pfName and its VFs
+func GetPFInfo(pfName string) (PFInfo, error) {
+	pciAddr, err := netdevPciAddress(pfName)
+	if err != nil {
+		return PFInfo{}, err
+	}
+	driver, err := GetDriverName(pciAddr)
+	if err != nil {
+		return PFInfo{}, err
+	}
+	totalVfs, err := readSriovAttr(pfName, "sriov_totalvfs")
+	if err != nil {
+		return PFInfo{}, err
+	}
+	vfs, err := ListVFs(pfName)
+	if err != nil {
+		return PFInfo{}, err
+	}
+
+	return PFInfo{
+		Name:       pfName,
+		PCIAddress: pciAddr,
+		Driver:     driver,
+		TotalVFs:   totalVfs,
+		NumVFs:     len(vfs),
+		VFs:        vfs,
+	}, nil
+}
+
+// GetInventory returns every SR-IOV capable PF of the host with its VFs,
+// sorted by PF name. Like ListAllVFs, a PF that can not be read does not
+// stop the others.
+func GetInventory() ([]PFInfo, error) {
+	pfNames, err := ListSriovCapablePFs()
+	if err != nil {
+		return nil, err
+	}
+
+	pfs := []PFInfo{}
+	var errs []error
+	for _, pfName := range pfNames {
+		pf, err := GetPFInfo(pfName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read PF %q: %w", pfName, err))
+			continue
+		}
+		pfs = append(pfs, pf)
+	}
+	return pfs, joinErrors(errs)
+}
+
+// MarshalInventory encodes pfs as indented JSON for tooling. The field
+// names are part of the output format and must not change.
+func MarshalInventory(pfs []PFInfo) ([]byte, error) {
+	if pfs == nil {
+		pfs = []PFInfo{}
+	}
+	data, err := json.MarshalIndent(pfs, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	return data, nil
+}
+
+// inContainerNetDev is the VFState netdev of a VF whose kernel netdev is not
+// in the host namespace, i.e. it was moved into a container
+const inContainerNetDev = "in-container"
+
+// VFState is a diagnostic snapshot of a VF of an SR-IOV PF
+type VFState struct {
+	VFID       int    `json:"vfId"`
+	PCIAddress string `json:"pciAddress"`
+	NetDev     string `json:"netDev"`
+	Driver     string `json:"driver"`
+	MAC        string `json:"mac"`
+	Vlan       int    `json:"vlan"`
+	Spoofchk   bool   `json:"spoofchk"`
+	// Error explains the fields that could not be read, the others are set
+	Error string `json:"error,omitempty"`
+}
+
+// GetVFStateSummary returns the state of every VF configured on pfName,
+// ordered by VF ID. A VF that can only be read partially is still reported,
+// with the failure noted in its Error field.
+func GetVFStateSummary(pfName string) ([]VFState, error) {
+	return GetVFStateSummaryContext(context.Background(), pfName)
+}
+
+// GetVFStateSummaryContext is GetVFStateSummary giving up with the context
+// error once ctx is done
+func GetVFStateSummaryContext(ctx context.Context, pfName string) ([]VFState, error) {
+	numVfs, err := GetSriovNumVfs(pfName)
+	if err != nil {
+		return nil, err
+	}
+
+	pfLink, err := netlinkOps.LinkByName(pfName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup PF %q: %w", pfName, err)
+	}
+	adminVfs := map[int]netlink.VfInfo{}
+	for _, vf := range pfLink.Attrs().Vfs {
+		adminVfs[vf.ID] = vf
+	}
+
+	states := make([]VFState, numVfs)
+	forEachConcurrently(ctx, numVfs, func(vfID int) {
+		states[vfID] = readVFState(pfName, vfID, adminVfs)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// readVFState returns the state of VF vfID on pfName, adminVfs being the
+// VFs reported by netlink for the PF
+func readVFState(pfName string, vfID int, adminVfs map[int]netlink.VfInfo) VFState {
+	state := VFState{VFID: vfID}
+	var errs []error
+
+	if pciAddr, err := GetPciAddress(pfName, vfID); err != nil {
+		errs = append(errs, err)
+	} else {
+		state.PCIAddress = pciAddr
+		if state.Driver, err = GetDriverName(pciAddr); err != nil {
+			errs = append(errs, err)
+		}
+		if netDevs, err := GetHostNetDevFromPci(pciAddr); err != nil {
+			errs = append(errs, err)
+		} else if len(netDevs) > 0 {
+			state.NetDev = netDevs[0]
+		} else if state.Driver != "" && !isUserspaceDriver(state.Driver) {
+			state.NetDev = inContainerNetDev
+		}
+	}
+
+	if vf, ok := adminVfs[vfID]; ok {
+		state.MAC = vf.Mac.String()
+		state.Vlan = vf.Vlan
+		state.Spoofchk = vf.Spoofchk
+	} else {
+		errs = append(errs, fmt.Errorf("VF %d not reported by netlink on PF %q", vfID, pfName))
+	}
+
+	if len(errs) > 0 {
+		state.Error = joinErrors(errs).Error()
+	}
+	return state
+}
@@ -0,0 +1,582 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// newInventorySysfs returns a fake tree with PF enp59s0f0 and four VFs:
+// VF 0 moved into a container, VF 1 bound to vfio-pci, VF 2 and VF 3 free
+// with netdevs in the host namespace
+func newInventorySysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2", "0000:3b:02.3")
+	f.bindDriver("0000:3b:02.0", "iavf")
+	f.bindDriver("0000:3b:02.1", "vfio-pci")
+	f.addNetdev("enp59s0f0v2", "0000:3b:02.2")
+	f.bindDriver("0000:3b:02.2", "iavf")
+	f.addNetdev("enp59s0f0v3", "0000:3b:02.3")
+	f.bindDriver("0000:3b:02.3", "iavf")
+	return f
+}
+
+func TestListVFs(t *testing.T) {
+	newInventorySysfs(t)
+
+	got, err := ListVFs("enp59s0f0")
+	if err != nil {
+		t.Fatalf("ListVFs() failed: %v", err)
+	}
+
+	want := []VFInfo{
+		{PFName: "enp59s0f0", VFID: 0, PCIAddress: "0000:3b:02.0", Driver: "iavf", NetDevs: []string{}},
+		{PFName: "enp59s0f0", VFID: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci", NetDevs: []string{}},
+		{PFName: "enp59s0f0", VFID: 2, PCIAddress: "0000:3b:02.2", Driver: "iavf", NetDevs: []string{"enp59s0f0v2"}},
+		{PFName: "enp59s0f0", VFID: 3, PCIAddress: "0000:3b:02.3", Driver: "iavf", NetDevs: []string{"enp59s0f0v3"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListVFs() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ListVFs("enp59s0f9"); err == nil {
+		t.Error("ListVFs() succeeded for a missing PF")
+	}
+}
+
+func TestGetFreeVF(t *testing.T) {
+	tests := map[string]struct {
+		setup   func(f *fakeSysfs)
+		wantID  int
+		wantPci string
+		wantErr error
+	}{
+		"first free VF": {
+			wantID:  2,
+			wantPci: "0000:3b:02.2",
+		},
+		"skips a taken VF": {
+			setup: func(f *fakeSysfs) {
+				f.remove(f.path("sys", "bus", "pci", "devices", "0000:3b:02.2", "net", "enp59s0f0v2"))
+			},
+			wantID:  3,
+			wantPci: "0000:3b:02.3",
+		},
+		"all VFs taken": {
+			setup: func(f *fakeSysfs) {
+				f.remove(f.path("sys", "bus", "pci", "devices", "0000:3b:02.2", "net"))
+				f.bindDriver("0000:3b:02.3", "vfio-pci")
+				f.remove(f.path("sys", "bus", "pci", "devices", "0000:3b:02.3", "net"))
+			},
+			wantErr: ErrNoFreeVF,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newInventorySysfs(t)
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+
+			vfID, pci, err := GetFreeVF("enp59s0f0")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetFreeVF() = %d, %q, %v, want error %v", vfID, pci, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetFreeVF() failed: %v", err)
+			}
+			if vfID != tt.wantID || pci != tt.wantPci {
+				t.Errorf("GetFreeVF() = %d, %q, want %d, %q", vfID, pci, tt.wantID, tt.wantPci)
+			}
+		})
+	}
+}
+
+func TestListMovedOutVFs(t *testing.T) {
+	f := newInventorySysfs(t)
+	// VF 4 is not bound to any driver, so it has no netdev either
+	f.addVF("0000:3b:00.0", 4, "0000:3b:02.4")
+	f.writeFile(filepath.Join(SysBusPci, "0000:3b:00.0", "sriov_numvfs"), "5\n")
+	// the only VF of another PF is moved out as well
+	f.addPF("enp59s0f1", "0000:3b:00.1", "0000:3b:0a.0")
+	f.bindDriver("0000:3b:0a.0", "mlx5_core")
+
+	tests := map[string]struct {
+		pfName  string
+		want    []VFInfo
+		wantErr bool
+	}{
+		"moved out, DPDK, unbound and free VFs": {
+			pfName: "enp59s0f0",
+			want:   []VFInfo{{PFName: "enp59s0f0", VFID: 0, PCIAddress: "0000:3b:02.0", Driver: "iavf", NetDevs: []string{}}},
+		},
+		"other PF": {
+			pfName: "enp59s0f1",
+			want:   []VFInfo{{PFName: "enp59s0f1", VFID: 0, PCIAddress: "0000:3b:0a.0", Driver: "mlx5_core", NetDevs: []string{}}},
+		},
+		"missing PF": {pfName: "enp59s0f9", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ListMovedOutVFs(tt.pfName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ListMovedOutVFs(%q) = %+v, want error", tt.pfName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListMovedOutVFs(%q) failed: %v", tt.pfName, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListMovedOutVFs(%q) = %+v, want %+v", tt.pfName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListMovedOutVFsNone(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0")
+	f.addNetdev("enp59s0f0v0", "0000:3b:02.0")
+	f.bindDriver("0000:3b:02.0", "iavf")
+
+	got, err := ListMovedOutVFs("enp59s0f0")
+	if err != nil {
+		t.Fatalf("ListMovedOutVFs() failed: %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("ListMovedOutVFs() = %#v, want an empty list", got)
+	}
+}
+
+func TestGetVFStateSummary(t *testing.T) {
+	f := newInventorySysfs(t)
+	// VF 4 is enabled but its PCI device was not populated yet
+	f.writeFile(filepath.Join(SysBusPci, "0000:3b:00.0", "sriov_numvfs"), "5\n")
+
+	pf := newFakePF("enp59s0f0", 5)
+	pf.Vfs[0].Mac = net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x00}
+	pf.Vfs[0].Vlan = 100
+	pf.Vfs[1].Spoofchk = false
+	// VF 3 is missing from the netlink dump
+	pf.Vfs = append(pf.Vfs[:3], pf.Vfs[4])
+	newFakeNetlink(t, pf)
+
+	got, err := GetVFStateSummary("enp59s0f0")
+	if err != nil {
+		t.Fatalf("GetVFStateSummary() failed: %v", err)
+	}
+
+	want := []VFState{
+		{VFID: 0, PCIAddress: "0000:3b:02.0", NetDev: "in-container", Driver: "iavf", MAC: "02:aa:bb:cc:dd:00", Vlan: 100, Spoofchk: true},
+		{VFID: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci"},
+		{VFID: 2, PCIAddress: "0000:3b:02.2", NetDev: "enp59s0f0v2", Driver: "iavf", Spoofchk: true},
+		{VFID: 3, PCIAddress: "0000:3b:02.3", NetDev: "enp59s0f0v3", Driver: "iavf"},
+		{VFID: 4, Spoofchk: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetVFStateSummary() returned %d VFs, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		// only the presence of the per VF error is checked, not its wording
+		hasError := got[i].Error != ""
+		if wantError := i >= 3; hasError != wantError {
+			t.Errorf("VF %d error = %q, want error %v", i, got[i].Error, wantError)
+		}
+		got[i].Error = ""
+		if got[i] != want[i] {
+			t.Errorf("VF %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGetVFStateSummaryErrors(t *testing.T) {
+	newInventorySysfs(t)
+
+	tests := map[string]struct {
+		pfName string
+		links  []netlink.Link
+	}{
+		"missing PF":        {pfName: "enp59s0f9"},
+		"PF not in netlink": {pfName: "enp59s0f0"},
+		"invalid PF":        {pfName: "../enp59s0f0", links: []netlink.Link{newFakePF("../enp59s0f0", 4)}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			newFakeNetlink(t, tt.links...)
+			if got, err := GetVFStateSummary(tt.pfName); err == nil {
+				t.Errorf("GetVFStateSummary(%q) = %+v, want error", tt.pfName, got)
+			}
+		})
+	}
+}
+
+// newNodeInventory returns a fake node with the SR-IOV PFs enp59s0f0 (two
+// VFs) and enp94s0f0 (one VF), the plain NIC eno1 and a link that vanished
+// from sysfs since the netlink dump
+func newNodeInventory(t *testing.T) (*fakeSysfs, *fakeNetlink) {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0", "0000:3b:02.1")
+	f.addNetdev("enp59s0f0v0", "0000:3b:02.0")
+	f.bindDriver("0000:3b:02.0", "iavf")
+	f.bindDriver("0000:3b:02.1", "vfio-pci")
+	f.addPF("enp94s0f0", "0000:5e:00.0", "0000:5e:02.0")
+	f.bindDriver("0000:5e:02.0", "mlx5_core")
+	f.addNetdev("eno1", "0000:01:00.0")
+
+	links := []netlink.Link{}
+	for _, name := range []string{"enp94s0f0", "eno1", "enp59s0f0", "enp59s0f0v0", "gone0"} {
+		links = append(links, &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name}})
+	}
+	return f, newFakeNetlink(t, links...)
+}
+
+func TestListSriovCapablePFs(t *testing.T) {
+	newNodeInventory(t)
+
+	got, err := ListSriovCapablePFs()
+	if err != nil {
+		t.Fatalf("ListSriovCapablePFs() failed: %v", err)
+	}
+	if want := []string{"enp59s0f0", "enp94s0f0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListSriovCapablePFs() = %v, want %v", got, want)
+	}
+}
+
+func TestListAllVFs(t *testing.T) {
+	newNodeInventory(t)
+
+	got, err := ListAllVFs()
+	if err != nil {
+		t.Fatalf("ListAllVFs() failed: %v", err)
+	}
+
+	want := []VFInfo{
+		{PFName: "enp59s0f0", VFID: 0, PCIAddress: "0000:3b:02.0", Driver: "iavf", NetDevs: []string{"enp59s0f0v0"}},
+		{PFName: "enp59s0f0", VFID: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci", NetDevs: []string{}},
+		{PFName: "enp94s0f0", VFID: 0, PCIAddress: "0000:5e:02.0", Driver: "mlx5_core", NetDevs: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListAllVFs() = %+v, want %+v", got, want)
+	}
+}
+
+func TestListAllVFsPartial(t *testing.T) {
+	f, _ := newNodeInventory(t)
+	// enp59s0f0 claims a third VF whose virtfn link is missing
+	f.writeFile(filepath.Join(SysBusPci, "0000:3b:00.0", "sriov_numvfs"), "3\n")
+
+	got, err := ListAllVFs()
+	if err == nil {
+		t.Fatal("ListAllVFs() succeeded, want the enp59s0f0 failure")
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ListAllVFs() error = %v, want it to wrap %v", err, os.ErrNotExist)
+	}
+
+	want := []VFInfo{
+		{PFName: "enp94s0f0", VFID: 0, PCIAddress: "0000:5e:02.0", Driver: "mlx5_core", NetDevs: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListAllVFs() = %+v, want the VFs of the other PF %+v", got, want)
+	}
+}
+
+func TestListAllVFsLinkListError(t *testing.T) {
+	_, nl := newNodeInventory(t)
+	nl.errs["LinkList"] = syscall.EPERM
+
+	if got, err := ListAllVFs(); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("ListAllVFs() = %+v, %v, want %v", got, err, syscall.EPERM)
+	}
+}
+
+// newLargeInventorySysfs returns a fake tree with PF enp59s0f0 and numVfs
+// VFs, each bound to iavf with a netdev in the host namespace
+func newLargeInventorySysfs(tb testing.TB, numVfs int) *fakeSysfs {
+	tb.Helper()
+
+	f := newFakeSysfs(tb)
+	vfPcis := make([]string, numVfs)
+	for vfID := range vfPcis {
+		vfPcis[vfID] = fmt.Sprintf("0000:3b:%02x.%d", 2+vfID/8, vfID%8)
+	}
+	f.addPF("enp59s0f0", "0000:3b:00.0", vfPcis...)
+	for vfID, vfPci := range vfPcis {
+		f.addNetdev(fmt.Sprintf("enp59s0f0v%d", vfID), vfPci)
+		f.bindDriver(vfPci, "iavf")
+	}
+	return f
+}
+
+func TestListVFsConcurrency(t *testing.T) {
+	newLargeInventorySysfs(t, 64)
+
+	var want []VFInfo
+	for _, concurrency := range []int{1, 4, 0, 128} {
+		saved := SysfsConcurrency
+		SysfsConcurrency = concurrency
+		got, err := ListVFs("enp59s0f0")
+		SysfsConcurrency = saved
+		if err != nil {
+			t.Fatalf("ListVFs() with concurrency %d failed: %v", concurrency, err)
+		}
+		for vfID, vf := range got {
+			if vf.VFID != vfID {
+				t.Fatalf("ListVFs() with concurrency %d: entry %d is VF %d", concurrency, vfID, vf.VFID)
+			}
+		}
+		if want == nil {
+			want = got
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("ListVFs() with concurrency %d = %+v, want %+v", concurrency, got, want)
+		}
+	}
+}
+
+func TestListVFsConcurrentError(t *testing.T) {
+	f := newLargeInventorySysfs(t, 32)
+	// VF 20 and VF 10 are gone, the lowest one is reported
+	f.remove(filepath.Join(SysBusPci, "0000:3b:00.0", "virtfn20"))
+	f.remove(filepath.Join(SysBusPci, "0000:3b:00.0", "virtfn10"))
+
+	_, err := ListVFs("enp59s0f0")
+	if err == nil || !strings.Contains(err.Error(), "VF 10 on") {
+		t.Errorf("ListVFs() error = %v, want the failure of VF 10", err)
+	}
+}
+
+func BenchmarkListVFs(b *testing.B) {
+	newLargeInventorySysfs(b, 256)
+
+	for name, concurrency := range map[string]int{"serial": 1, "parallel": 0} {
+		b.Run(name, func(b *testing.B) {
+			saved := SysfsConcurrency
+			b.Cleanup(func() { SysfsConcurrency = saved })
+			SysfsConcurrency = concurrency
+
+			for i := 0; i < b.N; i++ {
+				if _, err := ListVFs("enp59s0f0"); err != nil {
+					b.Fatalf("ListVFs() failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// countdownContext is a context that reports cancellation once Err was
+// called remaining times, cancelling a walk at a chosen point
+type countdownContext struct {
+	context.Context
+	remaining int32
+}
+
+func newCountdownContext(remaining int32) *countdownContext {
+	return &countdownContext{Context: context.Background(), remaining: remaining}
+}
+
+func (c *countdownContext) Err() error {
+	if atomic.AddInt32(&c.remaining, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestListAllVFsContextCancel(t *testing.T) {
+	newNodeInventory(t)
+	saved := SysfsConcurrency
+	t.Cleanup(func() { SysfsConcurrency = saved })
+	SysfsConcurrency = 1
+
+	all, err := ListAllVFs()
+	if err != nil {
+		t.Fatalf("ListAllVFs() failed: %v", err)
+	}
+
+	// cancel at every possible point of the walk until it completes
+	for remaining := int32(0); ; remaining++ {
+		got, err := ListAllVFsContext(newCountdownContext(remaining))
+		if err == nil {
+			if !reflect.DeepEqual(got, all) {
+				t.Errorf("ListAllVFsContext() = %+v, want %+v", got, all)
+			}
+			break
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("ListAllVFsContext() cancelled after %d checks: error = %v, want %v", remaining, err, context.Canceled)
+		}
+		if len(got) >= len(all) || (len(got) > 0 && !reflect.DeepEqual(got, all[:len(got)])) {
+			t.Errorf("ListAllVFsContext() cancelled after %d checks = %+v, want a strict prefix of %+v", remaining, got, all)
+		}
+	}
+}
+
+func TestListSriovCapablePFsContextCancel(t *testing.T) {
+	newNodeInventory(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if got, err := ListSriovCapablePFsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListSriovCapablePFsContext() = %v, %v, want %v", got, err, context.Canceled)
+	}
+	if got, err := ListAllVFsContext(ctx); !errors.Is(err, context.Canceled) || got != nil {
+		t.Errorf("ListAllVFsContext() = %+v, %v, want nil, %v", got, err, context.Canceled)
+	}
+}
+
+func TestGetVFStateSummaryContextCancel(t *testing.T) {
+	newLargeInventorySysfs(t, 64)
+	newFakeNetlink(t, newFakePF("enp59s0f0", 64))
+
+	for _, concurrency := range []int{1, 4} {
+		saved := SysfsConcurrency
+		SysfsConcurrency = concurrency
+		got, err := GetVFStateSummaryContext(newCountdownContext(10), "enp59s0f0")
+		SysfsConcurrency = saved
+		if !errors.Is(err, context.Canceled) || got != nil {
+			t.Errorf("GetVFStateSummaryContext() with concurrency %d = %d states, %v, want %v", concurrency, len(got), err, context.Canceled)
+		}
+	}
+
+	got, err := GetVFStateSummaryContext(context.Background(), "enp59s0f0")
+	if err != nil || len(got) != 64 {
+		t.Errorf("GetVFStateSummaryContext() = %d states, %v, want 64", len(got), err)
+	}
+}
+
+func TestGetInventory(t *testing.T) {
+	f, _ := newNodeInventory(t)
+	f.bindDriver("0000:3b:00.0", "ice")
+	f.bindDriver("0000:5e:00.0", "mlx5_core")
+
+	got, err := GetInventory()
+	if err != nil {
+		t.Fatalf("GetInventory() failed: %v", err)
+	}
+
+	want := []PFInfo{
+		{
+			Name: "enp59s0f0", PCIAddress: "0000:3b:00.0", Driver: "ice", TotalVFs: 64, NumVFs: 2,
+			VFs: []VFInfo{
+				{PFName: "enp59s0f0", VFID: 0, PCIAddress: "0000:3b:02.0", Driver: "iavf", NetDevs: []string{"enp59s0f0v0"}},
+				{PFName: "enp59s0f0", VFID: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci", NetDevs: []string{}},
+			},
+		},
+		{
+			Name: "enp94s0f0", PCIAddress: "0000:5e:00.0", Driver: "mlx5_core", TotalVFs: 64, NumVFs: 1,
+			VFs: []VFInfo{
+				{PFName: "enp94s0f0", VFID: 0, PCIAddress: "0000:5e:02.0", Driver: "mlx5_core", NetDevs: []string{}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInventory() = %+v, want %+v", got, want)
+	}
+
+	// a PF whose VFs can not be read is reported, the others still listed
+	f.writeFile(filepath.Join(SysBusPci, "0000:3b:00.0", "sriov_numvfs"), "3\n")
+	got, err = GetInventory()
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetInventory() error = %v, want it to wrap %v", err, os.ErrNotExist)
+	}
+	if !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("GetInventory() = %+v, want the other PF %+v", got, want[1:])
+	}
+}
+
+func TestMarshalInventory(t *testing.T) {
+	pfs := []PFInfo{{
+		Name:       "enp59s0f0",
+		PCIAddress: "0000:3b:00.0",
+		Driver:     "ice",
+		TotalVFs:   64,
+		NumVFs:     2,
+		VFs: []VFInfo{
+			{PFName: "enp59s0f0", VFID: 0, PCIAddress: "0000:3b:02.0", Driver: "iavf", NetDevs: []string{"enp59s0f0v0"}},
+			{PFName: "enp59s0f0", VFID: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci", NetDevs: []string{}},
+		},
+	}}
+
+	data, err := MarshalInventory(pfs)
+	if err != nil {
+		t.Fatalf("MarshalInventory() failed: %v", err)
+	}
+
+	// the field names are consumed by external tooling
+	want := `[
+  {
+    "name": "enp59s0f0",
+    "pciAddress": "0000:3b:00.0",
+    "driver": "ice",
+    "totalVfs": 64,
+    "numVfs": 2,
+    "vfs": [
+      {
+        "pfName": "enp59s0f0",
+        "vfId": 0,
+        "pciAddress": "0000:3b:02.0",
+        "driver": "iavf",
+        "netDevs": [
+          "enp59s0f0v0"
+        ]
+      },
+      {
+        "pfName": "enp59s0f0",
+        "vfId": 1,
+        "pciAddress": "0000:3b:02.1",
+        "driver": "vfio-pci",
+        "netDevs": []
+      }
+    ]
+  }
+]`
+	if string(data) != want {
+		t.Errorf("MarshalInventory() =\n%s\nwant\n%s", data, want)
+	}
+
+	var decoded []PFInfo
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+	if !reflect.DeepEqual(decoded, pfs) {
+		t.Errorf("decoded inventory = %+v, want %+v", decoded, pfs)
+	}
+}
+
+func TestMarshalInventoryEmpty(t *testing.T) {
+	for _, pfs := range [][]PFInfo{nil, {}} {
+		data, err := MarshalInventory(pfs)
+		if err != nil {
+			t.Fatalf("MarshalInventory(%#v) failed: %v", pfs, err)
+		}
+		if string(data) != "[]" {
+			t.Errorf("MarshalInventory(%#v) = %s, want []", pfs, data)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// normalizePciToMac validates every MAC in the mapping and returns a copy
+// with lower case PCI addresses and canonical lower case MAC addresses
+func normalizePciToMac(mapping map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(mapping))
+	for pciAddr, mac := range mapping {
+		hwAddr, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAC address %q for PCI address %q: %w", mac, pciAddr, err)
+		}
+		if !IsValidMACAddress(hwAddr) {
+			return nil, fmt.Errorf("invalid MAC address %q for PCI address %q", mac, pciAddr)
+		}
+		normalized[strings.ToLower(pciAddr)] = hwAddr.String()
+	}
+	return normalized, nil
+}
+
+// WritePciToMacFile atomically writes the PCI address to MAC address mapping
+// as JSON to path, replacing any existing content
+func WritePciToMacFile(path string, mapping map[string]string) error {
+	normalized, err := normalizePciToMac(mapping)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(normalized, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal PCI to MAC mapping: %w", err)
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
+
+// UpdatePciToMacFile merges updates into the PCI address to MAC address
+// mapping stored at path. The read-modify-write cycle is serialized with an
+// exclusive flock on a sibling lock file so concurrent writers do not lose
+// each other's entries. A missing file is treated as an empty mapping.
+func UpdatePciToMacFile(path string, updates map[string]string) error {
+	normalized, err := normalizePciToMac(updates)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(path+".lock", false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current := map[string]string{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return fmt.Errorf("failed to parse PCI to MAC file %q: %w", path, err)
+			}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to read PCI to MAC file %q: %w", path, err)
+	}
+
+	for pciAddr, mac := range normalized {
+		current[pciAddr] = mac
+	}
+
+	data, err = json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal PCI to MAC mapping: %w", err)
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
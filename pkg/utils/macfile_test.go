@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// readPciToMacFile decodes the PCI to MAC file at path
+func readPciToMacFile(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %q: %v", path, err)
+	}
+	mapping := map[string]string{}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		t.Fatalf("failed to parse %q: %v", path, err)
+	}
+	return mapping
+}
+
+func TestWritePciToMacFile(t *testing.T) {
+	tests := map[string]struct {
+		mapping map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		"valid mapping is normalized": {
+			mapping: map[string]string{
+				"0000:3B:02.0": "02:AA:BB:CC:DD:01",
+				"0000:3b:02.1": "02-aa-bb-cc-dd-02",
+			},
+			want: map[string]string{
+				"0000:3b:02.0": "02:aa:bb:cc:dd:01",
+				"0000:3b:02.1": "02:aa:bb:cc:dd:02",
+			},
+		},
+		"empty mapping": {
+			mapping: map[string]string{},
+			want:    map[string]string{},
+		},
+		"malformed MAC": {
+			mapping: map[string]string{"0000:3b:02.0": "not-a-mac"},
+			wantErr: true,
+		},
+		"zero MAC": {
+			mapping: map[string]string{"0000:3b:02.0": "00:00:00:00:00:00"},
+			wantErr: true,
+		},
+		"multicast MAC": {
+			mapping: map[string]string{"0000:3b:02.0": "01:00:5e:00:00:01"},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pci2mac.json")
+
+			err := WritePciToMacFile(path, tt.mapping)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("WritePciToMacFile() succeeded, want error")
+				}
+				if _, statErr := os.Stat(path); !errors.Is(statErr, os.ErrNotExist) {
+					t.Errorf("file %q written despite invalid mapping", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WritePciToMacFile() failed: %v", err)
+			}
+			if got := readPciToMacFile(t, path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("file content = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePciToMacFileReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pci2mac.json")
+
+	if err := WritePciToMacFile(path, map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:01"}); err != nil {
+		t.Fatalf("first WritePciToMacFile() failed: %v", err)
+	}
+	if err := WritePciToMacFile(path, map[string]string{"0000:3b:02.1": "02:aa:bb:cc:dd:02"}); err != nil {
+		t.Fatalf("second WritePciToMacFile() failed: %v", err)
+	}
+
+	want := map[string]string{"0000:3b:02.1": "02:aa:bb:cc:dd:02"}
+	if got := readPciToMacFile(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("file content = %v, want %v", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat %q: %v", path, err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file mode = %v, want 0600", perm)
+	}
+}
+
+func TestUpdatePciToMacFile(t *testing.T) {
+	tests := map[string]struct {
+		initial *string
+		updates map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		"first write creates the file": {
+			updates: map[string]string{"0000:3B:02.0": "02:AA:BB:CC:DD:01"},
+			want:    map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:01"},
+		},
+		"merge keeps existing entries": {
+			initial: stringPtr(`{"0000:3b:02.0": "02:aa:bb:cc:dd:01"}`),
+			updates: map[string]string{"0000:3b:02.1": "02:aa:bb:cc:dd:02"},
+			want: map[string]string{
+				"0000:3b:02.0": "02:aa:bb:cc:dd:01",
+				"0000:3b:02.1": "02:aa:bb:cc:dd:02",
+			},
+		},
+		"update overrides an entry": {
+			initial: stringPtr(`{"0000:3b:02.0": "02:aa:bb:cc:dd:01"}`),
+			updates: map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:ff"},
+			want:    map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:ff"},
+		},
+		"empty existing file": {
+			initial: stringPtr(""),
+			updates: map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:01"},
+			want:    map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:01"},
+		},
+		"corrupt existing file": {
+			initial: stringPtr("{"),
+			updates: map[string]string{"0000:3b:02.0": "02:aa:bb:cc:dd:01"},
+			wantErr: true,
+		},
+		"invalid MAC": {
+			updates: map[string]string{"0000:3b:02.0": "ff:ff:ff:ff:ff:ff"},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pci2mac.json")
+			if tt.initial != nil {
+				if err := os.WriteFile(path, []byte(*tt.initial), 0600); err != nil {
+					t.Fatalf("failed to write %q: %v", path, err)
+				}
+			}
+
+			err := UpdatePciToMacFile(path, tt.updates)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("UpdatePciToMacFile() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdatePciToMacFile() failed: %v", err)
+			}
+			if got := readPciToMacFile(t, path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("file content = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatePciToMacFileConcurrent(t *testing.T) {
+	const writers = 16
+	path := filepath.Join(t.TempDir(), "pci2mac.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pciAddr := fmt.Sprintf("0000:3b:%02x.0", i)
+			mac := fmt.Sprintf("02:aa:bb:cc:dd:%02x", i)
+			errs <- UpdatePciToMacFile(path, map[string]string{pciAddr: mac})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UpdatePciToMacFile() failed: %v", err)
+		}
+	}
+
+	got := readPciToMacFile(t, path)
+	if len(got) != writers {
+		t.Fatalf("file has %d entries, want %d: %v", len(got), writers, got)
+	}
+	for i := 0; i < writers; i++ {
+		pciAddr := fmt.Sprintf("0000:3b:%02x.0", i)
+		if want := fmt.Sprintf("02:aa:bb:cc:dd:%02x", i); got[pciAddr] != want {
+			t.Errorf("entry %q = %q, want %q", pciAddr, got[pciAddr], want)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,428 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+// ErrLinkDown is returned when the speed or duplex of an interface can not
+// be read because its link is down
+var ErrLinkDown = errors.New("link down / speed unknown")
+
+// ErrInterfaceNameExists is returned when renaming an interface to a name
+// that is already taken
+var ErrInterfaceNameExists = errors.New("interface name already exists")
+
+// cpuMaskRe matches the comma separated hex words of a cpumask
+var cpuMaskRe = regexp.MustCompile(`^[0-9a-fA-F]+(,[0-9a-fA-F]+)*$`)
+
+// InterfaceFlags are the IFF_* flags of a network device
+type InterfaceFlags struct {
+	Up           bool `json:"up"`
+	Broadcast    bool `json:"broadcast"`
+	Loopback     bool `json:"loopback"`
+	PointToPoint bool `json:"pointToPoint"`
+	Running      bool `json:"running"`
+	NoARP        bool `json:"noArp"`
+	Promisc      bool `json:"promisc"`
+	AllMulti     bool `json:"allMulti"`
+	Master       bool `json:"master"`
+	Slave        bool `json:"slave"`
+	Multicast    bool `json:"multicast"`
+}
+
+// IFF_* flag bits as defined in linux/if.h
+const (
+	iffUp           = 0x1
+	iffBroadcast    = 0x2
+	iffLoopback     = 0x8
+	iffPointToPoint = 0x10
+	iffRunning      = 0x40
+	iffNoARP        = 0x80
+	iffPromisc      = 0x100
+	iffAllMulti     = 0x200
+	iffMaster       = 0x400
+	iffSlave        = 0x800
+	iffMulticast    = 0x1000
+)
+
+// maxIfNameLen is the longest interface name allowed by the kernel
+// (IFNAMSIZ minus the terminating NUL)
+const maxIfNameLen = 15
+
+// ValidateInterfaceName checks that name is a valid Linux interface name
+func ValidateInterfaceName(name string) error {
+	if name == "" {
+		return errors.New("interface name is empty")
+	}
+	if len(name) > maxIfNameLen {
+		return fmt.Errorf("interface name %q is longer than %d characters", name, maxIfNameLen)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("interface name %q is not allowed", name)
+	}
+	for _, r := range name {
+		if r == '/' || r == ':' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("interface name %q contains invalid character %q", name, r)
+		}
+	}
+	return nil
+}
+
+// GetMasterInterface returns the name of the master (bond, bridge, ...) the
+// given interface is enslaved to, or an empty string when it has no master
+func GetMasterInterface(ifName string) (string, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return "", err
+	}
+	ifDir := filepath.Join(NetDirectory, ifName)
+	if _, err := os.Lstat(ifDir); err != nil {
+		return "", fmt.Errorf("failed to find interface %q: %w", ifName, err)
+	}
+
+	masterLink, err := os.Readlink(filepath.Join(ifDir, "master"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read master of interface %q: %w", ifName, err)
+	}
+	return filepath.Base(masterLink), nil
+}
+
+// GetLowerInterfaces returns the interfaces enslaved to the given bond or
+// bridge. The lower_* links are used when present, otherwise the bonding
+// slaves file is consulted. A plain interface returns an empty slice.
+func GetLowerInterfaces(ifName string) ([]string, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return nil, err
+	}
+	ifDir := filepath.Join(NetDirectory, ifName)
+	if _, err := os.Lstat(ifDir); err != nil {
+		return nil, fmt.Errorf("failed to find interface %q: %w", ifName, err)
+	}
+
+	lowerLinks, err := filepath.Glob(filepath.Join(ifDir, "lower_*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lower interfaces of %q: %w", ifName, err)
+	}
+	lowers := make([]string, 0, len(lowerLinks))
+	for _, link := range lowerLinks {
+		lowers = append(lowers, strings.TrimPrefix(filepath.Base(link), "lower_"))
+	}
+	if len(lowers) > 0 {
+		sort.Strings(lowers)
+		return lowers, nil
+	}
+
+	slaves, err := os.ReadFile(filepath.Join(ifDir, "bonding", "slaves"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lowers, nil
+		}
+		return nil, fmt.Errorf("failed to read bonding slaves of %q: %w", ifName, err)
+	}
+	lowers = append(lowers, strings.Fields(string(slaves))...)
+	sort.Strings(lowers)
+	return lowers, nil
+}
+
+// readLinkAttr reads a link attribute of ifName that the kernel refuses to
+// report while the link is down
+func readLinkAttr(ifName, attr string) (string, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(NetDirectory, ifName, attr))
+	if err != nil {
+		if errors.Is(err, syscall.EINVAL) {
+			return "", fmt.Errorf("failed to read %s of %q: %w", attr, ifName, ErrLinkDown)
+		}
+		return "", fmt.Errorf("failed to read %s of %q: %w", attr, ifName, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// GetLinkSpeed returns the negotiated link speed of ifName in Mbps
+func GetLinkSpeed(ifName string) (int, error) {
+	value, err := readLinkAttr(ifName, "speed")
+	if err != nil {
+		return 0, err
+	}
+
+	speed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse speed %q of %q: %w", value, ifName, err)
+	}
+	if speed <= 0 || uint32(speed) == math.MaxUint32 {
+		return 0, fmt.Errorf("invalid speed of %q: %w", ifName, ErrLinkDown)
+	}
+	return speed, nil
+}
+
+// GetDuplex returns the negotiated duplex ("full" or "half") of ifName
+func GetDuplex(ifName string) (string, error) {
+	duplex, err := readLinkAttr(ifName, "duplex")
+	if err != nil {
+		return "", err
+	}
+	if duplex == "unknown" {
+		return "", fmt.Errorf("invalid duplex of %q: %w", ifName, ErrLinkDown)
+	}
+	return duplex, nil
+}
+
+// linkNameInUse reports whether an interface called name exists in the
+// current network namespace
+func linkNameInUse(name string) (bool, error) {
+	links, err := netlinkOps.LinkList()
+	if err != nil {
+		return false, fmt.Errorf("failed to list links: %w", err)
+	}
+	for _, link := range links {
+		if link.Attrs().Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RenameInterface renames interface oldName to newName. The interface is
+// brought down for the rename and its admin state restored afterwards.
+func RenameInterface(oldName, newName string) error {
+	if err := ValidateInterfaceName(newName); err != nil {
+		return err
+	}
+
+	inUse, err := linkNameInUse(newName)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return fmt.Errorf("failed to rename %q to %q: %w", oldName, newName, ErrInterfaceNameExists)
+	}
+
+	link, err := netlinkOps.LinkByName(oldName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup interface %q: %w", oldName, err)
+	}
+
+	isUp := link.Attrs().Flags&net.FlagUp != 0
+	if isUp {
+		if err := netlinkOps.LinkSetDown(link); err != nil {
+			return fmt.Errorf("failed to set %q down: %w", oldName, err)
+		}
+	}
+
+	if err := netlinkOps.LinkSetName(link, newName); err != nil {
+		if isUp {
+			_ = netlinkOps.LinkSetUp(link)
+		}
+		return fmt.Errorf("failed to rename %q to %q: %w", oldName, newName, err)
+	}
+
+	if isUp {
+		if err := netlinkOps.LinkSetUp(link); err != nil {
+			return fmt.Errorf("failed to set %q up: %w", newName, err)
+		}
+	}
+	return nil
+}
+
+// netdevPciAddress returns the PCI address backing the netdev ifName
+func netdevPciAddress(ifName string) (string, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return "", err
+	}
+
+	devicePath, err := filepath.EvalSymlinks(filepath.Join(NetDirectory, ifName, "device"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve device of %q: %w", ifName, err)
+	}
+	return filepath.Base(devicePath), nil
+}
+
+// ShareSamePCI reports whether the netdevs ifA and ifB belong to the same
+// PCI function
+func ShareSamePCI(ifA, ifB string) (bool, error) {
+	pciA, err := netdevPciAddress(ifA)
+	if err != nil {
+		return false, err
+	}
+	pciB, err := netdevPciAddress(ifB)
+	if err != nil {
+		return false, err
+	}
+	return pciA == pciB, nil
+}
+
+// GetQueueCount returns the number of rx and tx queues of ifName. An
+// interface without a queues directory has no queues.
+func GetQueueCount(ifName string) (rx, tx int, err error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return 0, 0, err
+	}
+	ifDir := filepath.Join(NetDirectory, ifName)
+	if _, err := os.Lstat(ifDir); err != nil {
+		return 0, 0, fmt.Errorf("failed to find interface %q: %w", ifName, err)
+	}
+
+	queues, err := os.ReadDir(filepath.Join(ifDir, "queues"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("failed to read queues of %q: %w", ifName, err)
+	}
+
+	for _, queue := range queues {
+		switch {
+		case strings.HasPrefix(queue.Name(), "rx-"):
+			rx++
+		case strings.HasPrefix(queue.Name(), "tx-"):
+			tx++
+		}
+	}
+	return rx, tx, nil
+}
+
+// GetInterfaceIRQs returns the MSI/MSI-X interrupts of the device behind
+// ifName, sorted in ascending order
+func GetInterfaceIRQs(ifName string) ([]int, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(NetDirectory, ifName, "device", "msi_irqs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MSI IRQs of %q: %w", ifName, err)
+	}
+
+	irqs := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		irq, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		irqs = append(irqs, irq)
+	}
+	sort.Ints(irqs)
+	return irqs, nil
+}
+
+// SetIRQAffinity sets the CPU affinity of irq to the hex cpumask cpuMask,
+// e.g. "f" or "ffffffff,00000000"
+func SetIRQAffinity(irq int, cpuMask string) error {
+	if irq < 0 {
+		return fmt.Errorf("invalid IRQ %d", irq)
+	}
+	if !cpuMaskRe.MatchString(cpuMask) {
+		return fmt.Errorf("invalid cpu mask %q", cpuMask)
+	}
+	return writeSysfsFile(filepath.Join(ProcIrq, strconv.Itoa(irq), "smp_affinity"), cpuMask)
+}
+
+// isInterfaceUp reports whether ifName is operationally up. Devices
+// reporting an unknown operstate are considered up when they have carrier.
+func isInterfaceUp(ifName string) (bool, error) {
+	operState, err := os.ReadFile(filepath.Join(NetDirectory, ifName, "operstate"))
+	if err != nil {
+		// the interface is being registered or renamed, keep waiting
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read operstate of %q: %w", ifName, err)
+	}
+
+	switch strings.TrimSpace(string(operState)) {
+	case "up":
+		return true, nil
+	case "unknown":
+		carrier, err := os.ReadFile(filepath.Join(NetDirectory, ifName, "carrier"))
+		if err != nil {
+			// carrier can not be read while the interface is admin down
+			return false, nil
+		}
+		return strings.TrimSpace(string(carrier)) == "1", nil
+	}
+	return false, nil
+}
+
+// WaitForInterfaceUp waits up to timeout for ifName to exist in the host
+// namespace and come up
+func WaitForInterfaceUp(ifName string, timeout time.Duration) error {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return err
+	}
+
+	appeared := false
+	err := pollUntil(timeout, func() (bool, error) {
+		if _, err := os.Lstat(filepath.Join(NetDirectory, ifName)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to check interface %q: %w", ifName, err)
+		}
+		appeared = true
+		return isInterfaceUp(ifName)
+	})
+	if errors.Is(err, errPollTimeout) {
+		if !appeared {
+			return fmt.Errorf("interface %q did not appear within %v", ifName, timeout)
+		}
+		return fmt.Errorf("interface %q appeared but did not come up within %v", ifName, timeout)
+	}
+	return err
+}
+
+// parseInterfaceFlags decodes an IFF_* bitmask
+func parseInterfaceFlags(flags uint64) InterfaceFlags {
+	return InterfaceFlags{
+		Up:           flags&iffUp != 0,
+		Broadcast:    flags&iffBroadcast != 0,
+		Loopback:     flags&iffLoopback != 0,
+		PointToPoint: flags&iffPointToPoint != 0,
+		Running:      flags&iffRunning != 0,
+		NoARP:        flags&iffNoARP != 0,
+		Promisc:      flags&iffPromisc != 0,
+		AllMulti:     flags&iffAllMulti != 0,
+		Master:       flags&iffMaster != 0,
+		Slave:        flags&iffSlave != 0,
+		Multicast:    flags&iffMulticast != 0,
+	}
+}
+
+// GetInterfaceFlags returns the flags of ifName as read from sysfs
+func GetInterfaceFlags(ifName string) (InterfaceFlags, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return InterfaceFlags{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(NetDirectory, ifName, "flags"))
+	if err != nil {
+		return InterfaceFlags{}, fmt.Errorf("failed to read flags of %q: %w", ifName, err)
+	}
+
+	value := strings.TrimPrefix(strings.TrimSpace(string(data)), "0x")
+	flags, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return InterfaceFlags{}, fmt.Errorf("failed to parse flags %q of %q: %w", value, ifName, err)
+	}
+	return parseInterfaceFlags(flags), nil
+}
@@ -0,0 +1,574 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestGetMasterInterface(t *testing.T) {
+	f := newFakeSysfs(t)
+	bondDir := f.addNetdev("bond0", "")
+	f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	f.symlink(bondDir, filepath.Join(NetDirectory, "enp59s0f0", "master"))
+	f.addNetdev("enp59s0f1", "0000:3b:00.1")
+
+	tests := map[string]struct {
+		ifName  string
+		want    string
+		wantErr bool
+	}{
+		"bonded":            {ifName: "enp59s0f0", want: "bond0"},
+		"standalone":        {ifName: "enp59s0f1", want: ""},
+		"master itself":     {ifName: "bond0", want: ""},
+		"missing interface": {ifName: "enp59s0f2", wantErr: true},
+		"invalid name":      {ifName: "../bond0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetMasterInterface(tt.ifName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetMasterInterface(%q) = %q, want error", tt.ifName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMasterInterface(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetMasterInterface(%q) = %q, want %q", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLowerInterfaces(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	f.addNetdev("enp59s0f1", "0000:3b:00.1")
+
+	bondDir := f.addNetdev("bond0", "")
+	f.symlink(filepath.Join(NetDirectory, "enp59s0f1"), filepath.Join(bondDir, "lower_enp59s0f1"))
+	f.symlink(filepath.Join(NetDirectory, "enp59s0f0"), filepath.Join(bondDir, "lower_enp59s0f0"))
+
+	// older kernels only expose the bonding slaves file
+	legacyBondDir := f.addNetdev("bond1", "")
+	f.writeFile(filepath.Join(legacyBondDir, "bonding", "slaves"), "enp94s0f1 enp94s0f0\n")
+
+	emptyBondDir := f.addNetdev("bond2", "")
+	f.writeFile(filepath.Join(emptyBondDir, "bonding", "slaves"), "\n")
+
+	tests := map[string]struct {
+		ifName  string
+		want    []string
+		wantErr bool
+	}{
+		"bond with lower links": {ifName: "bond0", want: []string{"enp59s0f0", "enp59s0f1"}},
+		"bond with slaves file": {ifName: "bond1", want: []string{"enp94s0f0", "enp94s0f1"}},
+		"bond without slaves":   {ifName: "bond2", want: []string{}},
+		"standalone":            {ifName: "enp59s0f0", want: []string{}},
+		"missing interface":     {ifName: "bond9", wantErr: true},
+		"invalid name":          {ifName: "bond 0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetLowerInterfaces(tt.ifName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetLowerInterfaces(%q) = %v, want error", tt.ifName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetLowerInterfaces(%q) failed: %v", tt.ifName, err)
+			}
+			if got == nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetLowerInterfaces(%q) = %#v, want %#v", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInterfaceName(t *testing.T) {
+	tests := map[string]struct {
+		name    string
+		wantErr bool
+	}{
+		"short":             {name: "net1"},
+		"predictable":       {name: "enp59s0f0v12"},
+		"max length":        {name: "abcdefghijklmno"},
+		"dash and dot":      {name: "eth0.100-a"},
+		"empty":             {name: "", wantErr: true},
+		"too long":          {name: "abcdefghijklmnop", wantErr: true},
+		"slash":             {name: "eth0/1", wantErr: true},
+		"path traversal":    {name: "../eth0", wantErr: true},
+		"space":             {name: "eth 0", wantErr: true},
+		"tab":               {name: "eth\t0", wantErr: true},
+		"newline":           {name: "eth0\n", wantErr: true},
+		"control character": {name: "eth\x000", wantErr: true},
+		"colon":             {name: "eth0:1", wantErr: true},
+		"dot":               {name: ".", wantErr: true},
+		"dot dot":           {name: "..", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateInterfaceName(tt.name)
+			if tt.wantErr && err == nil {
+				t.Errorf("ValidateInterfaceName(%q) succeeded, want error", tt.name)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateInterfaceName(%q) failed: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+// newLinkStateSysfs returns a fake tree with the link enp59s0f0 up at 25G
+// full duplex and the links enp59s0f1 and enp59s0f2 down, as reported by
+// older and newer kernels respectively
+func newLinkStateSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	upDir := f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	f.writeFile(filepath.Join(upDir, "speed"), "25000\n")
+	f.writeFile(filepath.Join(upDir, "duplex"), "full\n")
+	downDir := f.addNetdev("enp59s0f1", "0000:3b:00.1")
+	f.writeFile(filepath.Join(downDir, "speed"), "-1\n")
+	f.writeFile(filepath.Join(downDir, "duplex"), "unknown\n")
+	unknownDir := f.addNetdev("enp59s0f2", "0000:3b:00.2")
+	f.writeFile(filepath.Join(unknownDir, "speed"), "4294967295\n")
+	f.writeFile(filepath.Join(unknownDir, "duplex"), "unknown\n")
+	return f
+}
+
+func TestGetLinkSpeed(t *testing.T) {
+	newLinkStateSysfs(t)
+
+	tests := map[string]struct {
+		ifName  string
+		want    int
+		wantErr error
+	}{
+		"link up":           {ifName: "enp59s0f0", want: 25000},
+		"link down":         {ifName: "enp59s0f1", wantErr: ErrLinkDown},
+		"speed unknown":     {ifName: "enp59s0f2", wantErr: ErrLinkDown},
+		"missing interface": {ifName: "enp59s0f3"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetLinkSpeed(tt.ifName)
+			if tt.want == 0 {
+				if err == nil {
+					t.Fatalf("GetLinkSpeed(%q) = %d, want error", tt.ifName, got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetLinkSpeed(%q) error = %v, want %v", tt.ifName, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetLinkSpeed(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetLinkSpeed(%q) = %d, want %d", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDuplex(t *testing.T) {
+	newLinkStateSysfs(t)
+
+	tests := map[string]struct {
+		ifName  string
+		want    string
+		wantErr error
+	}{
+		"link up":           {ifName: "enp59s0f0", want: "full"},
+		"link down":         {ifName: "enp59s0f1", wantErr: ErrLinkDown},
+		"missing interface": {ifName: "enp59s0f3"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetDuplex(tt.ifName)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("GetDuplex(%q) = %q, want error", tt.ifName, got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetDuplex(%q) error = %v, want %v", tt.ifName, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDuplex(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetDuplex(%q) = %q, want %q", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameInterface(t *testing.T) {
+	tests := map[string]struct {
+		oldName string
+		newName string
+		up      bool
+		errs    map[string]error
+		wantErr error
+		// wantName is the name of the link afterwards, empty for an error
+		wantName string
+	}{
+		"up link":          {oldName: "enp59s0f0v0", newName: "net1", up: true, wantName: "net1"},
+		"down link":        {oldName: "enp59s0f0v0", newName: "net1", wantName: "net1"},
+		"name taken":       {oldName: "enp59s0f0v0", newName: "enp59s0f0v1", wantErr: ErrInterfaceNameExists},
+		"missing link":     {oldName: "enp59s0f0v9", newName: "net1"},
+		"invalid new name": {oldName: "enp59s0f0v0", newName: "net/1"},
+		"rename fails":     {oldName: "enp59s0f0v0", newName: "net1", up: true, errs: map[string]error{"LinkSetName": syscall.EPERM}, wantErr: syscall.EPERM},
+		"list fails":       {oldName: "enp59s0f0v0", newName: "net1", errs: map[string]error{"LinkList": syscall.EPERM}, wantErr: syscall.EPERM},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			link := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "enp59s0f0v0"}}
+			if tt.up {
+				link.Flags = net.FlagUp
+			}
+			other := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "enp59s0f0v1"}}
+			f := newFakeNetlink(t, link, other)
+			for method, err := range tt.errs {
+				f.errs[method] = err
+			}
+
+			err := RenameInterface(tt.oldName, tt.newName)
+			if tt.wantName == "" {
+				if err == nil {
+					t.Fatalf("RenameInterface(%q, %q) succeeded, want error", tt.oldName, tt.newName)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("RenameInterface(%q, %q) error = %v, want %v", tt.oldName, tt.newName, err, tt.wantErr)
+				}
+				if link.Name != "enp59s0f0v0" {
+					t.Errorf("link renamed to %q despite the error", link.Name)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("RenameInterface(%q, %q) failed: %v", tt.oldName, tt.newName, err)
+				}
+				if link.Name != tt.wantName {
+					t.Errorf("link name = %q, want %q", link.Name, tt.wantName)
+				}
+			}
+			if isUp := link.Flags&net.FlagUp != 0; isUp != tt.up {
+				t.Errorf("link up = %v, want the original state %v", isUp, tt.up)
+			}
+		})
+	}
+}
+
+func TestShareSamePCI(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	f.addNetdev("enp59s0f0d1", "0000:3b:00.0")
+	f.addNetdev("enp59s0f1", "0000:3b:00.1")
+	// sysfs links are relative, as in ../../../0000:3b:00.0
+	relDir := f.addNetdev("enp59s0f0d2", "")
+	f.symlink("../../../bus/pci/devices/0000:3b:00.0", filepath.Join(relDir, "device"))
+	f.addNetdev("lo", "")
+
+	tests := map[string]struct {
+		ifA, ifB string
+		want     bool
+		wantErr  bool
+	}{
+		"ports of one function":  {ifA: "enp59s0f0", ifB: "enp59s0f0d1", want: true},
+		"relative device link":   {ifA: "enp59s0f0d2", ifB: "enp59s0f0", want: true},
+		"different functions":    {ifA: "enp59s0f0", ifB: "enp59s0f1"},
+		"same netdev":            {ifA: "enp59s0f1", ifB: "enp59s0f1", want: true},
+		"netdev without device":  {ifA: "enp59s0f0", ifB: "lo", wantErr: true},
+		"missing netdev":         {ifA: "enp59s0f9", ifB: "enp59s0f0", wantErr: true},
+		"invalid interface name": {ifA: "enp59s0f0", ifB: "../lo", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ShareSamePCI(tt.ifA, tt.ifB)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ShareSamePCI(%q, %q) = %v, want error", tt.ifA, tt.ifB, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ShareSamePCI(%q, %q) failed: %v", tt.ifA, tt.ifB, err)
+			}
+			if got != tt.want {
+				t.Errorf("ShareSamePCI(%q, %q) = %v, want %v", tt.ifA, tt.ifB, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetQueueCount(t *testing.T) {
+	f := newFakeSysfs(t)
+	ifDir := f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	for _, queue := range []string{"rx-0", "rx-1", "rx-2", "rx-3", "tx-0", "tx-1"} {
+		f.mkdir(filepath.Join(ifDir, "queues", queue))
+	}
+	f.writeFile(filepath.Join(ifDir, "queues", "README"), "not a queue\n")
+	f.mkdir(filepath.Join(f.addNetdev("enp59s0f1", "0000:3b:00.1"), "queues"))
+	f.addNetdev("dummy0", "")
+
+	tests := map[string]struct {
+		ifName  string
+		wantRx  int
+		wantTx  int
+		wantErr bool
+	}{
+		"rx and tx queues":       {ifName: "enp59s0f0", wantRx: 4, wantTx: 2},
+		"empty queues directory": {ifName: "enp59s0f1"},
+		"no queues directory":    {ifName: "dummy0"},
+		"missing interface":      {ifName: "enp59s0f9", wantErr: true},
+		"invalid interface name": {ifName: "../dummy0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rx, tx, err := GetQueueCount(tt.ifName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetQueueCount(%q) = %d, %d, want error", tt.ifName, rx, tx)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetQueueCount(%q) failed: %v", tt.ifName, err)
+			}
+			if rx != tt.wantRx || tx != tt.wantTx {
+				t.Errorf("GetQueueCount(%q) = %d, %d, want %d, %d", tt.ifName, rx, tx, tt.wantRx, tt.wantTx)
+			}
+		})
+	}
+}
+
+func TestGetInterfaceIRQs(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	for _, irq := range []string{"130", "98", "99", "1024"} {
+		f.writeFile(filepath.Join(SysBusPci, "0000:3b:00.0", "msi_irqs", irq), "msix\n")
+	}
+	f.addNetdev("enp59s0f1", "0000:3b:00.1")
+	f.addNetdev("dummy0", "")
+
+	tests := map[string]struct {
+		ifName  string
+		want    []int
+		wantErr bool
+	}{
+		"MSI-X device":           {ifName: "enp59s0f0", want: []int{98, 99, 130, 1024}},
+		"no msi_irqs directory":  {ifName: "enp59s0f1", wantErr: true},
+		"virtual interface":      {ifName: "dummy0", wantErr: true},
+		"invalid interface name": {ifName: "../dummy0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetInterfaceIRQs(tt.ifName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetInterfaceIRQs(%q) = %v, want error", tt.ifName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetInterfaceIRQs(%q) failed: %v", tt.ifName, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetInterfaceIRQs(%q) = %v, want %v", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetIRQAffinity(t *testing.T) {
+	tests := map[string]struct {
+		irq     int
+		cpuMask string
+		wantErr bool
+	}{
+		"single word mask": {irq: 98, cpuMask: "f"},
+		"multi word mask":  {irq: 98, cpuMask: "ffffffff,00000000"},
+		"cpu list":         {irq: 98, cpuMask: "0-3", wantErr: true},
+		"empty mask":       {irq: 98, cpuMask: "", wantErr: true},
+		"negative IRQ":     {irq: -1, cpuMask: "f", wantErr: true},
+		"missing IRQ":      {irq: 99, cpuMask: "f", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			affinityFile := filepath.Join(ProcIrq, "98", "smp_affinity")
+			f.writeFile(affinityFile, "ffff\n")
+
+			err := SetIRQAffinity(tt.irq, tt.cpuMask)
+			want := tt.cpuMask
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SetIRQAffinity(%d, %q) succeeded, want error", tt.irq, tt.cpuMask)
+				}
+				want = "ffff\n"
+			} else if err != nil {
+				t.Fatalf("SetIRQAffinity(%d, %q) failed: %v", tt.irq, tt.cpuMask, err)
+			}
+			if got, _ := os.ReadFile(affinityFile); string(got) != want {
+				t.Errorf("smp_affinity = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWaitForInterfaceUp(t *testing.T) {
+	f := newFakeSysfs(t)
+	ifDir := filepath.Join(NetDirectory, "enp59s0f0v1")
+
+	// the netdev registers without operstate, then comes up later
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f.mkdir(ifDir)
+		time.Sleep(150 * time.Millisecond)
+		f.writeFile(filepath.Join(ifDir, "operstate"), "down\n")
+		time.Sleep(150 * time.Millisecond)
+		f.writeFile(filepath.Join(ifDir, "operstate"), "up\n")
+	}()
+
+	if err := WaitForInterfaceUp("enp59s0f0v1", 5*time.Second); err != nil {
+		t.Fatalf("WaitForInterfaceUp() failed: %v", err)
+	}
+}
+
+func TestWaitForInterfaceUpTimeout(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.writeFile(filepath.Join(f.addNetdev("enp59s0f0", ""), "operstate"), "down\n")
+	unknownDir := f.addNetdev("enp59s0f1", "")
+	f.writeFile(filepath.Join(unknownDir, "operstate"), "unknown\n")
+	f.writeFile(filepath.Join(unknownDir, "carrier"), "0\n")
+	carrierDir := f.addNetdev("enp59s0f2", "")
+	f.writeFile(filepath.Join(carrierDir, "operstate"), "unknown\n")
+	f.writeFile(filepath.Join(carrierDir, "carrier"), "1\n")
+
+	tests := map[string]struct {
+		ifName  string
+		wantErr string
+	}{
+		"never appears":             {ifName: "enp59s0f9", wantErr: "did not appear"},
+		"never comes up":            {ifName: "enp59s0f0", wantErr: "did not come up"},
+		"unknown state, no carrier": {ifName: "enp59s0f1", wantErr: "did not come up"},
+		"unknown state, carrier":    {ifName: "enp59s0f2"},
+		"invalid interface name":    {ifName: "../enp59s0f0", wantErr: "invalid character"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := WaitForInterfaceUp(tt.ifName, 200*time.Millisecond)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("WaitForInterfaceUp(%q) failed: %v", tt.ifName, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("WaitForInterfaceUp(%q) error = %v, want %q", tt.ifName, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetInterfaceFlags(t *testing.T) {
+	tests := map[string]struct {
+		flags   string
+		want    InterfaceFlags
+		wantErr bool
+	}{
+		"up ethernet": {
+			flags: "0x1003\n",
+			want:  InterfaceFlags{Up: true, Broadcast: true, Multicast: true},
+		},
+		"down ethernet": {
+			flags: "0x1002\n",
+			want:  InterfaceFlags{Broadcast: true, Multicast: true},
+		},
+		"loopback": {
+			flags: "0x9\n",
+			want:  InterfaceFlags{Up: true, Loopback: true},
+		},
+		"promiscuous bond slave": {
+			flags: "0x1943\n",
+			want:  InterfaceFlags{Up: true, Broadcast: true, Running: true, Promisc: true, Slave: true, Multicast: true},
+		},
+		"bond master": {
+			flags: "0x1603\n",
+			want:  InterfaceFlags{Up: true, Broadcast: true, AllMulti: true, Master: true, Multicast: true},
+		},
+		"point to point without ARP": {
+			flags: "0x91\n",
+			want:  InterfaceFlags{Up: true, PointToPoint: true, NoARP: true},
+		},
+		"without 0x prefix": {
+			flags: "1003\n",
+			want:  InterfaceFlags{Up: true, Broadcast: true, Multicast: true},
+		},
+		"malformed flags": {flags: "0xzz\n", wantErr: true},
+		"empty flags":     {flags: "", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			f.writeFile(filepath.Join(f.addNetdev("enp59s0f0", ""), "flags"), tt.flags)
+
+			got, err := GetInterfaceFlags("enp59s0f0")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetInterfaceFlags() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetInterfaceFlags() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetInterfaceFlags() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInterfaceFlagsMissing(t *testing.T) {
+	newFakeSysfs(t)
+
+	for _, ifName := range []string{"enp59s0f9", "../lo"} {
+		if _, err := GetInterfaceFlags(ifName); err == nil {
+			t.Errorf("GetInterfaceFlags(%q) succeeded, want error", ifName)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// netlinkManager is the subset of the netlink library used by the package,
+// so tests can substitute a fake
+type netlinkManager interface {
+	LinkByName(name string) (netlink.Link, error)
+	LinkList() ([]netlink.Link, error)
+	LinkSetUp(link netlink.Link) error
+	LinkSetDown(link netlink.Link) error
+	LinkSetName(link netlink.Link, name string) error
+	LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error
+	LinkSetMTU(link netlink.Link, mtu int) error
+	LinkSetVfHardwareAddr(link netlink.Link, vf int, hwaddr net.HardwareAddr) error
+	LinkSetVfVlanQos(link netlink.Link, vf, vlan, qos int) error
+	LinkSetVfVlanQosProto(link netlink.Link, vf, vlan, qos, proto int) error
+	LinkSetVfRate(link netlink.Link, vf, minRate, maxRate int) error
+	LinkSetVfTxRate(link netlink.Link, vf, rate int) error
+	LinkSetVfSpoofchk(link netlink.Link, vf int, check bool) error
+	LinkSetVfTrust(link netlink.Link, vf int, state bool) error
+	LinkSetVfState(link netlink.Link, vf int, state uint32) error
+}
+
+// netlinkLib is the netlinkManager backed by the netlink library
+type netlinkLib struct{}
+
+// netlinkOps is the netlinkManager used by the package
+var netlinkOps netlinkManager = netlinkLib{}
+
+func (netlinkLib) LinkByName(name string) (netlink.Link, error) {
+	return netlink.LinkByName(name)
+}
+
+func (netlinkLib) LinkList() ([]netlink.Link, error) {
+	return netlink.LinkList()
+}
+
+func (netlinkLib) LinkSetUp(link netlink.Link) error {
+	return netlink.LinkSetUp(link)
+}
+
+func (netlinkLib) LinkSetDown(link netlink.Link) error {
+	return netlink.LinkSetDown(link)
+}
+
+func (netlinkLib) LinkSetName(link netlink.Link, name string) error {
+	return netlink.LinkSetName(link, name)
+}
+
+func (netlinkLib) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	return netlink.LinkSetHardwareAddr(link, hwaddr)
+}
+
+func (netlinkLib) LinkSetMTU(link netlink.Link, mtu int) error {
+	return netlink.LinkSetMTU(link, mtu)
+}
+
+func (netlinkLib) LinkSetVfHardwareAddr(link netlink.Link, vf int, hwaddr net.HardwareAddr) error {
+	return netlink.LinkSetVfHardwareAddr(link, vf, hwaddr)
+}
+
+func (netlinkLib) LinkSetVfVlanQos(link netlink.Link, vf, vlan, qos int) error {
+	return netlink.LinkSetVfVlanQos(link, vf, vlan, qos)
+}
+
+func (netlinkLib) LinkSetVfVlanQosProto(link netlink.Link, vf, vlan, qos, proto int) error {
+	return netlink.LinkSetVfVlanQosProto(link, vf, vlan, qos, proto)
+}
+
+func (netlinkLib) LinkSetVfRate(link netlink.Link, vf, minRate, maxRate int) error {
+	return netlink.LinkSetVfRate(link, vf, minRate, maxRate)
+}
+
+func (netlinkLib) LinkSetVfTxRate(link netlink.Link, vf, rate int) error {
+	return netlink.LinkSetVfTxRate(link, vf, rate)
+}
+
+func (netlinkLib) LinkSetVfSpoofchk(link netlink.Link, vf int, check bool) error {
+	return netlink.LinkSetVfSpoofchk(link, vf, check)
+}
+
+func (netlinkLib) LinkSetVfTrust(link netlink.Link, vf int, state bool) error {
+	return netlink.LinkSetVfTrust(link, vf, state)
+}
+
+func (netlinkLib) LinkSetVfState(link netlink.Link, vf int, state uint32) error {
+	return netlink.LinkSetVfState(link, vf, state)
+}
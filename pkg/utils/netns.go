@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+// RunInNetns runs fn inside the network namespace at netnsPath. The calling
+// goroutine's namespace is left untouched and a panic in fn is turned into
+// an error so the namespace switch is always undone.
+func RunInNetns(netnsPath string, fn func() error) error {
+	return ns.WithNetNSPath(netnsPath, func(ns.NetNS) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic while running in netns %q: %v", netnsPath, r)
+			}
+		}()
+		return fn()
+	})
+}
+
+// SetNetdevMACInNetns sets the MAC address of ifName inside the network
+// namespace at netnsPath. The interface is brought down for the change and
+// its admin state restored afterwards.
+func SetNetdevMACInNetns(netnsPath, ifName string, mac net.HardwareAddr) error {
+	if !IsValidMACAddress(mac) {
+		return fmt.Errorf("invalid MAC address %q", mac)
+	}
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return err
+	}
+
+	return RunInNetns(netnsPath, func() error {
+		link, err := netlink.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q in netns %q: %w", ifName, netnsPath, err)
+		}
+
+		isUp := link.Attrs().Flags&net.FlagUp != 0
+		if isUp {
+			if err := netlink.LinkSetDown(link); err != nil {
+				return fmt.Errorf("failed to set %q down: %w", ifName, err)
+			}
+		}
+
+		setErr := netlink.LinkSetHardwareAddr(link, mac)
+		if isUp {
+			if err := netlink.LinkSetUp(link); err != nil && setErr == nil {
+				return fmt.Errorf("failed to set %q up: %w", ifName, err)
+			}
+		}
+		if setErr != nil {
+			return fmt.Errorf("failed to set MAC %q on %q: %w", mac, ifName, setErr)
+		}
+		return nil
+	})
+}
+
+// RestoreNetdevToHost moves ifNameInContainer out of the network namespace at
+// netnsPath back into the host namespace, renaming it to originalName on the
+// way. An interface already restored to the host, or whose netns is already
+// gone while the interface is back on the host, is not an error. If
+// originalName is already taken on the host it fails with a wrapped
+// ErrInterfaceNameExists. When the move fails the interface keeps its
+// container name and admin state.
+func RestoreNetdevToHost(netnsPath, ifNameInContainer, originalName string) error {
+	if err := ValidateInterfaceName(originalName); err != nil {
+		return err
+	}
+
+	hostNS, err := ns.GetNS(HostNetns)
+	if err != nil {
+		return fmt.Errorf("failed to open host netns %q: %w", HostNetns, err)
+	}
+	defer func() { _ = hostNS.Close() }()
+
+	// the same check RenameInterface runs, done up front so a clash on the
+	// host leaves the container interface untouched
+	nameTaken, err := InterfaceNameInUse(HostNetns, originalName)
+	if err != nil {
+		return err
+	}
+
+	moved := false
+	err = RunInNetns(netnsPath, func() error {
+		link, err := netlink.LinkByName(ifNameInContainer)
+		if err != nil {
+			if errors.As(err, &netlink.LinkNotFoundError{}) {
+				return nil
+			}
+			return fmt.Errorf("failed to lookup %q in netns %q: %w", ifNameInContainer, netnsPath, err)
+		}
+		if nameTaken {
+			return fmt.Errorf("failed to restore %q to host as %q: %w", ifNameInContainer, originalName, ErrInterfaceNameExists)
+		}
+
+		isUp := link.Attrs().Flags&net.FlagUp != 0
+		// put the interface back as the container had it, so a retried DEL
+		// finds it again
+		rollback := func() {
+			if link.Attrs().Name != ifNameInContainer {
+				_ = netlink.LinkSetName(link, ifNameInContainer)
+			}
+			if isUp {
+				_ = netlink.LinkSetUp(link)
+			}
+		}
+
+		if err := netlink.LinkSetDown(link); err != nil {
+			return fmt.Errorf("failed to set %q down: %w", ifNameInContainer, err)
+		}
+		if ifNameInContainer != originalName {
+			if err := netlink.LinkSetName(link, originalName); err != nil {
+				rollback()
+				return fmt.Errorf("failed to rename %q to %q: %w", ifNameInContainer, originalName, err)
+			}
+			link.Attrs().Name = originalName
+		}
+		if err := netlink.LinkSetNsFd(link, int(hostNS.Fd())); err != nil {
+			rollback()
+			return fmt.Errorf("failed to move %q to host netns: %w", originalName, err)
+		}
+		moved = true
+		return nil
+	})
+	if err != nil && !errors.As(err, &ns.NSPathNotExistErr{}) {
+		return err
+	}
+	if moved {
+		return nil
+	}
+
+	// not found in the container, check whether a previous DEL restored it
+	return hostNS.Do(func(ns.NetNS) error {
+		if _, err := netlink.LinkByName(originalName); err != nil {
+			return fmt.Errorf("interface %q found neither in netns %q nor as %q on the host: %w",
+				ifNameInContainer, netnsPath, originalName, err)
+		}
+		return nil
+	})
+}
+
+// GetMTUInNetns returns the MTU of ifName inside the network namespace at
+// netnsPath. An interface missing from the netns fails with a wrapped
+// netlink.LinkNotFoundError.
+func GetMTUInNetns(netnsPath, ifName string) (int, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return 0, err
+	}
+
+	mtu := 0
+	err := RunInNetns(netnsPath, func() error {
+		link, err := netlink.LinkByName(ifName)
+		if err != nil {
+			if errors.As(err, &netlink.LinkNotFoundError{}) {
+				return fmt.Errorf("interface %q not found in netns %q: %w", ifName, netnsPath, err)
+			}
+			return fmt.Errorf("failed to lookup %q in netns %q: %w", ifName, netnsPath, err)
+		}
+		mtu = link.Attrs().MTU
+		return nil
+	})
+	return mtu, err
+}
+
+// InterfaceNameInUse reports whether an interface called name already exists
+// in the network namespace at netnsPath
+func InterfaceNameInUse(netnsPath, name string) (bool, error) {
+	if err := ValidateInterfaceName(name); err != nil {
+		return false, err
+	}
+
+	inUse := false
+	err := RunInNetns(netnsPath, func() error {
+		var err error
+		inUse, err = linkNameInUse(name)
+		if err != nil {
+			return fmt.Errorf("failed to check name %q in netns %q: %w", name, netnsPath, err)
+		}
+		return nil
+	})
+	return inUse, err
+}
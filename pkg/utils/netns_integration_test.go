@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+//go:build integration
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/vishvananda/netlink"
+)
+
+// newTestNetns creates a network namespace removed at the end of the test.
+// It needs CAP_SYS_ADMIN and CAP_NET_ADMIN, the test is skipped otherwise.
+func newTestNetns(t *testing.T) ns.NetNS {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("network namespace tests must run as root")
+	}
+	netns, err := testutils.NewNS()
+	if err != nil {
+		t.Fatalf("failed to create netns: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = netns.Close()
+		_ = testutils.UnmountNS(netns)
+	})
+	return netns
+}
+
+// addTestLink creates the interface name in netns, one end of a veth pair
+// whose peer is named name+"p"
+func addTestLink(t *testing.T, netns ns.NetNS, name string) {
+	t.Helper()
+
+	err := netns.Do(func(ns.NetNS) error {
+		return netlink.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: name}, PeerName: name + "p"})
+	})
+	if err != nil {
+		t.Fatalf("failed to add link %q: %v", name, err)
+	}
+}
+
+func TestRunInNetns(t *testing.T) {
+	netns := newTestNetns(t)
+	addTestLink(t, netns, "evpntest0")
+
+	err := RunInNetns(netns.Path(), func() error {
+		_, err := netlink.LinkByName("evpntest0")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("link not visible inside the netns: %v", err)
+	}
+
+	if _, err := netlink.LinkByName("evpntest0"); err == nil {
+		t.Error("link of the test netns visible in the original netns")
+	}
+}
+
+func TestRunInNetnsError(t *testing.T) {
+	netns := newTestNetns(t)
+	wantErr := errors.New("callback failed")
+
+	err := RunInNetns(netns.Path(), func() error { return wantErr })
+	if !errors.Is(err, wantErr) {
+		t.Errorf("RunInNetns() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestRunInNetnsPanic(t *testing.T) {
+	netns := newTestNetns(t)
+	addTestLink(t, netns, "evpntest0")
+
+	err := RunInNetns(netns.Path(), func() error {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("RunInNetns() error = %v, want the recovered panic", err)
+	}
+
+	// the netns switch was undone, so the namespaces still work as usual
+	if _, err := netlink.LinkByName("evpntest0"); err == nil {
+		t.Error("link of the test netns visible in the original netns after a panic")
+	}
+	err = RunInNetns(netns.Path(), func() error {
+		_, err := netlink.LinkByName("evpntest0")
+		return err
+	})
+	if err != nil {
+		t.Errorf("RunInNetns() after a panic failed: %v", err)
+	}
+}
+
+func TestSetNetdevMACInNetns(t *testing.T) {
+	tests := map[string]struct {
+		up bool
+	}{
+		"up interface":   {up: true},
+		"down interface": {up: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			netns := newTestNetns(t)
+			addTestLink(t, netns, "evpntest0")
+			if tt.up {
+				err := netns.Do(func(ns.NetNS) error {
+					link, err := netlink.LinkByName("evpntest0")
+					if err != nil {
+						return err
+					}
+					return netlink.LinkSetUp(link)
+				})
+				if err != nil {
+					t.Fatalf("failed to set link up: %v", err)
+				}
+			}
+
+			mac := net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}
+			if err := SetNetdevMACInNetns(netns.Path(), "evpntest0", mac); err != nil {
+				t.Fatalf("SetNetdevMACInNetns() failed: %v", err)
+			}
+
+			err := netns.Do(func(ns.NetNS) error {
+				link, err := netlink.LinkByName("evpntest0")
+				if err != nil {
+					return err
+				}
+				if got := link.Attrs().HardwareAddr; !bytes.Equal(got, mac) {
+					t.Errorf("MAC = %v, want %v", got, mac)
+				}
+				if isUp := link.Attrs().Flags&net.FlagUp != 0; isUp != tt.up {
+					t.Errorf("link up = %v, want the original state %v", isUp, tt.up)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to check link: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetNetdevMACInNetnsMissingLink(t *testing.T) {
+	netns := newTestNetns(t)
+
+	mac := net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}
+	if err := SetNetdevMACInNetns(netns.Path(), "evpntest0", mac); err == nil {
+		t.Error("SetNetdevMACInNetns() succeeded for a missing link, want error")
+	}
+}
+
+// useTestHostNetns makes a fresh netns stand in for the host namespace
+func useTestHostNetns(t *testing.T) ns.NetNS {
+	t.Helper()
+
+	hostNS := newTestNetns(t)
+	saved := HostNetns
+	t.Cleanup(func() { HostNetns = saved })
+	HostNetns = hostNS.Path()
+	return hostNS
+}
+
+// testLinkState returns whether name exists in netns and is up
+func testLinkState(t *testing.T, netns ns.NetNS, name string) (exists, up bool) {
+	t.Helper()
+
+	err := netns.Do(func(ns.NetNS) error {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			if errors.As(err, &netlink.LinkNotFoundError{}) {
+				return nil
+			}
+			return err
+		}
+		exists = true
+		up = link.Attrs().Flags&net.FlagUp != 0
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to lookup %q: %v", name, err)
+	}
+	return exists, up
+}
+
+func TestRestoreNetdevToHost(t *testing.T) {
+	hostNS := useTestHostNetns(t)
+	containerNS := newTestNetns(t)
+	addTestLink(t, containerNS, "net1")
+
+	if err := RestoreNetdevToHost(containerNS.Path(), "net1", "enp59s0f0v1"); err != nil {
+		t.Fatalf("RestoreNetdevToHost() failed: %v", err)
+	}
+	if exists, _ := testLinkState(t, hostNS, "enp59s0f0v1"); !exists {
+		t.Error("interface not restored to the host under its original name")
+	}
+	if exists, _ := testLinkState(t, containerNS, "net1"); exists {
+		t.Error("interface still in the container netns")
+	}
+
+	// a retried DEL finds the interface already restored
+	if err := RestoreNetdevToHost(containerNS.Path(), "net1", "enp59s0f0v1"); err != nil {
+		t.Errorf("second RestoreNetdevToHost() failed: %v", err)
+	}
+
+	// the container netns may be gone by the time DEL is retried
+	_ = containerNS.Close()
+	if err := testutils.UnmountNS(containerNS); err != nil {
+		t.Fatalf("failed to remove container netns: %v", err)
+	}
+	if err := RestoreNetdevToHost(containerNS.Path(), "net1", "enp59s0f0v1"); err != nil {
+		t.Errorf("RestoreNetdevToHost() with the netns gone failed: %v", err)
+	}
+	if err := RestoreNetdevToHost(containerNS.Path(), "net1", "enp59s0f0v2"); err == nil {
+		t.Error("RestoreNetdevToHost() succeeded for an interface missing everywhere, want error")
+	}
+}
+
+func TestRestoreNetdevToHostSameName(t *testing.T) {
+	hostNS := useTestHostNetns(t)
+	containerNS := newTestNetns(t)
+	addTestLink(t, containerNS, "enp59s0f0v1")
+
+	if err := RestoreNetdevToHost(containerNS.Path(), "enp59s0f0v1", "enp59s0f0v1"); err != nil {
+		t.Fatalf("RestoreNetdevToHost() failed: %v", err)
+	}
+	if exists, _ := testLinkState(t, hostNS, "enp59s0f0v1"); !exists {
+		t.Error("interface not restored to the host")
+	}
+}
+
+func TestRestoreNetdevToHostMoveFails(t *testing.T) {
+	tests := map[string]struct {
+		clashOnHost bool
+		wantErr     error
+	}{
+		// refused up front by the InterfaceNameInUse check
+		"name taken on host": {clashOnHost: true, wantErr: ErrInterfaceNameExists},
+		// the rename itself fails and is rolled back
+		"name taken in container": {clashOnHost: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hostNS := useTestHostNetns(t)
+			containerNS := newTestNetns(t)
+			addTestLink(t, containerNS, "net1")
+			err := containerNS.Do(func(ns.NetNS) error {
+				link, err := netlink.LinkByName("net1")
+				if err != nil {
+					return err
+				}
+				return netlink.LinkSetUp(link)
+			})
+			if err != nil {
+				t.Fatalf("failed to set link up: %v", err)
+			}
+			if tc.clashOnHost {
+				addTestLink(t, hostNS, "enp59s0f0v1")
+			} else {
+				addTestLink(t, containerNS, "enp59s0f0v1")
+			}
+
+			err = RestoreNetdevToHost(containerNS.Path(), "net1", "enp59s0f0v1")
+			if err == nil {
+				t.Fatal("RestoreNetdevToHost() succeeded despite the name clash, want error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("RestoreNetdevToHost() = %v, want %v", err, tc.wantErr)
+			}
+			exists, up := testLinkState(t, containerNS, "net1")
+			if !exists || !up {
+				t.Errorf("container interface exists = %v, up = %v, want it back as net1 and up", exists, up)
+			}
+			if exists, _ := testLinkState(t, hostNS, "net1"); exists {
+				t.Error("container interface moved to the host")
+			}
+		})
+	}
+}
+
+func TestGetMTUInNetns(t *testing.T) {
+	netns := newTestNetns(t)
+	addTestLink(t, netns, "net1")
+	err := netns.Do(func(ns.NetNS) error {
+		link, err := netlink.LinkByName("net1")
+		if err != nil {
+			return err
+		}
+		return netlink.LinkSetMTU(link, 1450)
+	})
+	if err != nil {
+		t.Fatalf("failed to set MTU: %v", err)
+	}
+
+	tests := map[string]struct {
+		ifName string
+		want   int
+	}{
+		"configured MTU": {ifName: "net1", want: 1450},
+		"default MTU":    {ifName: "net1p", want: 1500},
+		"loopback":       {ifName: "lo", want: 65536},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetMTUInNetns(netns.Path(), tt.ifName)
+			if err != nil {
+				t.Fatalf("GetMTUInNetns(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetMTUInNetns(%q) = %d, want %d", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMTUInNetnsMissingLink(t *testing.T) {
+	netns := newTestNetns(t)
+
+	_, err := GetMTUInNetns(netns.Path(), "net1")
+	if !errors.As(err, &netlink.LinkNotFoundError{}) {
+		t.Errorf("GetMTUInNetns() error = %v, want netlink.LinkNotFoundError", err)
+	}
+}
+
+func TestInterfaceNameInUse(t *testing.T) {
+	netns := newTestNetns(t)
+	addTestLink(t, netns, "net1")
+
+	tests := map[string]struct {
+		name string
+		want bool
+	}{
+		"existing interface": {name: "net1", want: true},
+		"veth peer":          {name: "net1p", want: true},
+		"loopback":           {name: "lo", want: true},
+		"free name":          {name: "net2", want: false},
+		"prefix of a name":   {name: "net", want: false},
+		"in another netns":   {name: "evpnother0", want: false},
+	}
+	addTestLink(t, newTestNetns(t), "evpnother0")
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := InterfaceNameInUse(netns.Path(), tt.name)
+			if err != nil {
+				t.Fatalf("InterfaceNameInUse(%q) failed: %v", tt.name, err)
+			}
+			if got != tt.want {
+				t.Errorf("InterfaceNameInUse(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
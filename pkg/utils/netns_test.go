@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+)
+
+func TestRunInNetnsMissingPath(t *testing.T) {
+	called := false
+	err := RunInNetns(filepath.Join(t.TempDir(), "missing"), func() error {
+		called = true
+		return nil
+	})
+	if !errors.As(err, &ns.NSPathNotExistErr{}) {
+		t.Errorf("RunInNetns() error = %v, want ns.NSPathNotExistErr", err)
+	}
+	if called {
+		t.Error("RunInNetns() ran the callback without entering the netns")
+	}
+}
+
+func TestSetNetdevMACInNetnsValidation(t *testing.T) {
+	// the netns does not exist: validation must fail before entering it
+	netnsPath := filepath.Join(t.TempDir(), "missing")
+
+	tests := map[string]struct {
+		ifName string
+		mac    net.HardwareAddr
+	}{
+		"zero MAC":      {ifName: "net1", mac: net.HardwareAddr{0, 0, 0, 0, 0, 0}},
+		"multicast MAC": {ifName: "net1", mac: net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01}},
+		"short MAC":     {ifName: "net1", mac: net.HardwareAddr{0x02, 0xaa}},
+		"invalid name":  {ifName: "net/1", mac: net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}},
+		"empty name":    {ifName: "", mac: net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := SetNetdevMACInNetns(netnsPath, tt.ifName, tt.mac)
+			if err == nil {
+				t.Fatal("SetNetdevMACInNetns() succeeded, want error")
+			}
+			if errors.As(err, &ns.NSPathNotExistErr{}) {
+				t.Errorf("SetNetdevMACInNetns() entered the netns before validating: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetMTUInNetnsValidation(t *testing.T) {
+	netnsPath := filepath.Join(t.TempDir(), "missing")
+
+	if _, err := GetMTUInNetns(netnsPath, "net/1"); err == nil || errors.As(err, &ns.NSPathNotExistErr{}) {
+		t.Errorf("GetMTUInNetns() error = %v, want a validation error before entering the netns", err)
+	}
+	if _, err := GetMTUInNetns(netnsPath, "net1"); !errors.As(err, &ns.NSPathNotExistErr{}) {
+		t.Errorf("GetMTUInNetns() error = %v, want ns.NSPathNotExistErr", err)
+	}
+}
+
+func TestInterfaceNameInUseValidation(t *testing.T) {
+	netnsPath := filepath.Join(t.TempDir(), "missing")
+
+	for _, name := range []string{"", "net/1", "averyveryverylongname"} {
+		if _, err := InterfaceNameInUse(netnsPath, name); err == nil || errors.As(err, &ns.NSPathNotExistErr{}) {
+			t.Errorf("InterfaceNameInUse(%q) error = %v, want a validation error before entering the netns", name, err)
+		}
+	}
+	if _, err := InterfaceNameInUse(netnsPath, "net1"); !errors.As(err, &ns.NSPathNotExistErr{}) {
+		t.Errorf("InterfaceNameInUse() error = %v, want ns.NSPathNotExistErr", err)
+	}
+}
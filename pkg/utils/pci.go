@@ -0,0 +1,488 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPCIEnableUnavailable is returned when the kernel does not expose the
+// enable attribute of a PCI device
+var ErrPCIEnableUnavailable = errors.New("PCI device enable attribute is not available")
+
+// IsVfioReady checks that the IOMMU is enabled on the host and that the PCI
+// device has been assigned an iommu group, both required to bind vfio-pci
+func IsVfioReady(pciAddr string) (bool, error) {
+	groups, err := os.ReadDir(SysKernelIommuGroups)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read %q: %w", SysKernelIommuGroups, err)
+	}
+	if len(groups) == 0 {
+		return false, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr)); err != nil {
+		return false, fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr, "iommu_group")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check iommu group of %q: %w", pciAddr, err)
+	}
+	return true, nil
+}
+
+// GetIOMMUGroup returns the iommu group number of the PCI device
+func GetIOMMUGroup(pciAddr string) (int, error) {
+	groupLink, err := os.Readlink(filepath.Join(SysBusPci, pciAddr, "iommu_group"))
+	if err != nil {
+		return -1, fmt.Errorf("failed to read iommu group of %q: %w", pciAddr, err)
+	}
+
+	group, err := strconv.Atoi(filepath.Base(groupLink))
+	if err != nil {
+		return -1, fmt.Errorf("failed to parse iommu group %q of %q: %w", groupLink, pciAddr, err)
+	}
+	return group, nil
+}
+
+// ListIOMMUGroupDevices returns the PCI addresses of all devices in the
+// given iommu group
+func ListIOMMUGroupDevices(group int) ([]string, error) {
+	devicesDir := filepath.Join(SysKernelIommuGroups, strconv.Itoa(group), "devices")
+	entries, err := os.ReadDir(devicesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read devices of iommu group %d: %w", group, err)
+	}
+
+	devices := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		devices = append(devices, entry.Name())
+	}
+	return devices, nil
+}
+
+// GetHostNetDevFromPci returns the host network device names of the PCI
+// device. An empty slice is returned when the device has no netdev in the
+// host namespace, e.g. when it was moved into a container.
+func GetHostNetDevFromPci(pciAddress string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddress)); err != nil {
+		return nil, fmt.Errorf("failed to find PCI device %q: %w", pciAddress, err)
+	}
+
+	netDir := filepath.Join(SysBusPci, pciAddress, "net")
+	if _, err := os.Lstat(netDir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to check net directory of %q: %w", pciAddress, err)
+	}
+	return getFileNamesFromPath(netDir)
+}
+
+// GetAllNetDevsForPci returns all network device names of the PCI device
+// sorted by name, for cards exposing more than one netdev per function
+func GetAllNetDevsForPci(pciAddr string) ([]string, error) {
+	netDevs, err := GetHostNetDevFromPci(pciAddr)
+	if err != nil {
+		return nil, err
+	}
+	if len(netDevs) == 0 {
+		return nil, fmt.Errorf("no net devices found for PCI device %q", pciAddr)
+	}
+
+	sort.Strings(netDevs)
+	return netDevs, nil
+}
+
+// pciAddressRe matches a DDDD:BB:DD.F PCI address, the domain being
+// optional. Domains are 32 bits wide, VMD and Hyper-V use domains beyond
+// ffff.
+var pciAddressRe = regexp.MustCompile(`^(?:([0-9a-fA-F]{4,8}):)?([0-9a-fA-F]{2}):([0-9a-fA-F]{2})\.([0-7])$`)
+
+// maxPciDevice is the highest device number on a PCI bus
+const maxPciDevice = 0x1f
+
+// ParsePCIAddress decodes a PCI address in the DDDD:BB:DD.F form, or the
+// short BB:DD.F form which implies domain 0
+func ParsePCIAddress(addr string) (domain, bus, device, function int, err error) {
+	m := pciAddressRe.FindStringSubmatch(addr)
+	if m == nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid PCI address %q", addr)
+	}
+
+	parts := make([]uint64, 4)
+	for i, part := range m[1:] {
+		if part == "" {
+			continue
+		}
+		if parts[i], err = strconv.ParseUint(part, 16, 32); err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("invalid PCI address %q: %w", addr, err)
+		}
+	}
+	if parts[2] > maxPciDevice {
+		return 0, 0, 0, 0, fmt.Errorf("invalid PCI address %q: device %#x out of range", addr, parts[2])
+	}
+	return int(parts[0]), int(parts[1]), int(parts[2]), int(parts[3]), nil
+}
+
+// userspaceDrivers are the PCI drivers used to hand a device to DPDK
+var userspaceDrivers = []string{"vfio-pci", "uio_pci_generic", "igb_uio"}
+
+// DpdkDeviceInfo describes a PCI device bound to a userspace driver
+type DpdkDeviceInfo struct {
+	PCIAddress string `json:"pci-address"`
+	Driver     string `json:"driver"`
+	NumaNode   int    `json:"numa-node"`
+}
+
+// GetDriverName returns the name of the driver the PCI device is bound to,
+// or an empty string when it is not bound to any driver
+func GetDriverName(pciAddr string) (string, error) {
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr)); err != nil {
+		return "", fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	driverLink, err := os.Readlink(filepath.Join(SysBusPci, pciAddr, "driver"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read driver of %q: %w", pciAddr, err)
+	}
+	return filepath.Base(driverLink), nil
+}
+
+// HasDpdkDriver checks if the PCI device is bound to a userspace driver
+func HasDpdkDriver(pciAddr string) (bool, error) {
+	driver, err := GetDriverName(pciAddr)
+	if err != nil {
+		return false, err
+	}
+	return isUserspaceDriver(driver), nil
+}
+
+// isUserspaceDriver reports whether driver hands its devices to userspace
+func isUserspaceDriver(driver string) bool {
+	for _, drv := range userspaceDrivers {
+		if driver == drv {
+			return true
+		}
+	}
+	return false
+}
+
+// GetNumaNode returns the NUMA node of the PCI device, -1 meaning the
+// device has no NUMA affinity
+func GetNumaNode(pciAddr string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(SysBusPci, pciAddr, "numa_node"))
+	if err != nil {
+		return -1, fmt.Errorf("failed to read NUMA node of %q: %w", pciAddr, err)
+	}
+
+	node, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1, fmt.Errorf("failed to parse NUMA node of %q: %w", pciAddr, err)
+	}
+	return node, nil
+}
+
+// GetDpdkDeviceInfo returns the details of a PCI device bound to a
+// userspace driver for reporting in the CNI result
+func GetDpdkDeviceInfo(pciAddr string) (DpdkDeviceInfo, error) {
+	isDpdk, err := HasDpdkDriver(pciAddr)
+	if err != nil {
+		return DpdkDeviceInfo{}, err
+	}
+	if !isDpdk {
+		return DpdkDeviceInfo{}, fmt.Errorf("PCI device %q is not bound to a userspace driver", pciAddr)
+	}
+
+	driver, err := GetDriverName(pciAddr)
+	if err != nil {
+		return DpdkDeviceInfo{}, err
+	}
+
+	numaNode, err := GetNumaNode(pciAddr)
+	if err != nil {
+		return DpdkDeviceInfo{}, err
+	}
+
+	return DpdkDeviceInfo{
+		PCIAddress: pciAddr,
+		Driver:     driver,
+		NumaNode:   numaNode,
+	}, nil
+}
+
+// PredictableNameForPci returns the path based name (enpXsY[fZ][vW]) that
+// systemd/udev derives for the netdev of the PCI device. The name actually
+// assigned also depends on the udev rules and naming scheme of the host, so
+// this is meant as a hint for correlating devices, not a guarantee.
+func PredictableNameForPci(pciAddr string) (string, error) {
+	devDir := filepath.Join(SysBusPci, pciAddr)
+	if _, err := os.Stat(devDir); err != nil {
+		return "", fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	physfn, err := os.Readlink(filepath.Join(devDir, "physfn"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return pciPathName(pciAddr)
+		}
+		return "", fmt.Errorf("failed to read physfn of %q: %w", pciAddr, err)
+	}
+
+	// a VF is named after its PF with the VF index appended
+	pfAddr := filepath.Base(physfn)
+	pfName, err := pciPathName(pfAddr)
+	if err != nil {
+		return "", err
+	}
+
+	virtfns, err := filepath.Glob(filepath.Join(SysBusPci, pfAddr, "virtfn*"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list VFs of %q: %w", pfAddr, err)
+	}
+	for _, virtfn := range virtfns {
+		vfLink, err := os.Readlink(virtfn)
+		if err != nil || filepath.Base(vfLink) != pciAddr {
+			continue
+		}
+		return pfName + "v" + strings.TrimPrefix(filepath.Base(virtfn), "virtfn"), nil
+	}
+	return "", fmt.Errorf("failed to find VF index of %q on PF %q", pciAddr, pfAddr)
+}
+
+// pciPathName builds the udev path based name of a PCI function. The
+// function suffix is only added for multi-function devices.
+func pciPathName(pciAddr string) (string, error) {
+	domain, bus, slot, function, err := ParsePCIAddress(pciAddr)
+	if err != nil {
+		return "", err
+	}
+
+	name := "en"
+	if domain != 0 {
+		name += fmt.Sprintf("P%d", domain)
+	}
+	name += fmt.Sprintf("p%ds%d", bus, slot)
+
+	siblings, err := filepath.Glob(filepath.Join(SysBusPci, fmt.Sprintf("%04x:%02x:%02x.*", domain, bus, slot)))
+	if err != nil {
+		return "", fmt.Errorf("failed to list functions of %q: %w", pciAddr, err)
+	}
+	if function > 0 || len(siblings) > 1 {
+		name += fmt.Sprintf("f%d", function)
+	}
+	return name, nil
+}
+
+// IsPCIDeviceEnabled reports whether the PCI device is enabled
+func IsPCIDeviceEnabled(pciAddr string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr)); err != nil {
+		return false, fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(SysBusPci, pciAddr, "enable"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to read enable of %q: %w", pciAddr, ErrPCIEnableUnavailable)
+		}
+		return false, fmt.Errorf("failed to read enable of %q: %w", pciAddr, err)
+	}
+
+	enabled, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse enable of %q: %w", pciAddr, err)
+	}
+	return enabled != 0, nil
+}
+
+// GetDriverOverride returns the driver_override of the PCI device, or an
+// empty string when no override is set
+func GetDriverOverride(pciAddr string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(SysBusPci, pciAddr, "driver_override"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read driver_override of %q: %w", pciAddr, err)
+	}
+
+	override := strings.TrimSpace(string(data))
+	if override == "(null)" {
+		return "", nil
+	}
+	return override, nil
+}
+
+// SetDriverOverride sets the driver_override of the PCI device, an empty
+// driver clearing the override
+func SetDriverOverride(pciAddr, driver string) error {
+	return writeSysfsFile(filepath.Join(SysBusPci, pciAddr, "driver_override"), driver+"\n")
+}
+
+// GetModalias returns the modalias of the PCI device
+func GetModalias(pciAddr string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(SysBusPci, pciAddr, "modalias"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read modalias of %q: %w", pciAddr, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// WaitForDriver waits up to timeout for the PCI device to be bound to
+// driver. Binding to a different driver fails immediately.
+func WaitForDriver(pciAddr, driver string, timeout time.Duration) error {
+	err := pollUntil(timeout, func() (bool, error) {
+		current, err := GetDriverName(pciAddr)
+		if err != nil {
+			return false, err
+		}
+		if current != "" && current != driver {
+			return false, fmt.Errorf("PCI device %q bound to %q, expected %q", pciAddr, current, driver)
+		}
+		return current == driver, nil
+	})
+	if errors.Is(err, errPollTimeout) {
+		return fmt.Errorf("PCI device %q not bound to %q after %v", pciAddr, driver, timeout)
+	}
+	return err
+}
+
+// VFOnNumaNode reports whether the VF at vfPci is local to NUMA node node.
+// A VF without NUMA affinity (-1) matches any node.
+func VFOnNumaNode(vfPci string, node int) (bool, error) {
+	vfNode, err := GetNumaNode(vfPci)
+	if err != nil {
+		return false, err
+	}
+	return vfNode == -1 || vfNode == node, nil
+}
+
+// GetVFLinkNamesWait waits up to timeout for the VF at pciAddr to register
+// a host netdev and returns its names. A VF bound to a userspace driver
+// never gets a netdev, so an empty slice is returned for it right away.
+func GetVFLinkNamesWait(pciAddr string, timeout time.Duration) ([]string, error) {
+	isDpdk, err := HasDpdkDriver(pciAddr)
+	if err != nil {
+		return nil, err
+	}
+	if isDpdk {
+		return []string{}, nil
+	}
+
+	var names []string
+	err = pollUntil(timeout, func() (bool, error) {
+		var err error
+		names, err = GetHostNetDevFromPci(pciAddr)
+		return len(names) > 0, err
+	})
+	if errors.Is(err, errPollTimeout) {
+		return nil, fmt.Errorf("no net device found for PCI device %q after %v", pciAddr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// pciClassNetwork is the PCI base class of network controllers
+const pciClassNetwork = 0x02
+
+// IsNetworkDevice reports whether the PCI device is a network controller
+// according to its class code
+func IsNetworkDevice(pciAddr string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(SysBusPci, pciAddr, "class"))
+	if err != nil {
+		return false, fmt.Errorf("failed to read class of %q: %w", pciAddr, err)
+	}
+
+	class, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 32)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse class of %q: %w", pciAddr, err)
+	}
+	return class>>16 == pciClassNetwork, nil
+}
+
+// driverBindTimeout bounds how long SwapDriver waits for a driver to bind, a
+// variable so tests can shorten it
+var driverBindTimeout = 5 * time.Second
+
+// unbindDriver unbinds the PCI device from its current driver, if any
+func unbindDriver(pciAddr string) error {
+	driver, err := GetDriverName(pciAddr)
+	if err != nil || driver == "" {
+		return err
+	}
+	return writeSysfsFile(filepath.Join(SysBusPci, pciAddr, "driver", "unbind"), pciAddr)
+}
+
+// probeDriver asks the kernel to bind the PCI device to a matching driver,
+// honoring its driver_override
+func probeDriver(pciAddr string) error {
+	return writeSysfsFile(filepath.Join(filepath.Dir(SysBusPci), "drivers_probe"), pciAddr)
+}
+
+// rebindDriver binds the PCI device to driver through driver_override and
+// waits for the binding to complete
+func rebindDriver(pciAddr, driver string) error {
+	if err := SetDriverOverride(pciAddr, driver); err != nil {
+		return err
+	}
+	if err := unbindDriver(pciAddr); err != nil {
+		return err
+	}
+	if err := probeDriver(pciAddr); err != nil {
+		return err
+	}
+	return WaitForDriver(pciAddr, driver, driverBindTimeout)
+}
+
+// SwapDriver moves the PCI device from fromDriver to toDriver, e.g. from the
+// kernel VF driver to vfio-pci. When any step fails the device is bound back
+// to fromDriver and its original driver_override restored.
+func SwapDriver(pciAddr, fromDriver, toDriver string) error {
+	current, err := GetDriverName(pciAddr)
+	if err != nil {
+		return err
+	}
+	if current != fromDriver {
+		return fmt.Errorf("PCI device %q bound to %q, expected %q", pciAddr, current, fromDriver)
+	}
+	if fromDriver == toDriver {
+		return nil
+	}
+
+	origOverride, err := GetDriverOverride(pciAddr)
+	if err != nil {
+		return err
+	}
+
+	swapErr := rebindDriver(pciAddr, toDriver)
+	if swapErr == nil {
+		return nil
+	}
+
+	errs := []error{fmt.Errorf("failed to bind %q to %q: %w", pciAddr, toDriver, swapErr)}
+	if err := rebindDriver(pciAddr, fromDriver); err != nil {
+		errs = append(errs, fmt.Errorf("failed to roll back %q to %q: %w", pciAddr, fromDriver, err))
+	}
+	if err := SetDriverOverride(pciAddr, origOverride); err != nil {
+		errs = append(errs, fmt.Errorf("failed to restore driver_override of %q: %w", pciAddr, err))
+	}
+	return joinErrors(errs)
+}
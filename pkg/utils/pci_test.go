@@ -0,0 +1,905 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsVfioReady(t *testing.T) {
+	tests := map[string]struct {
+		setup   func(f *fakeSysfs)
+		pciAddr string
+		want    bool
+		wantErr bool
+	}{
+		"iommu enabled": {
+			setup: func(f *fakeSysfs) {
+				f.addIommuGroup("0000:3b:02.0", 42)
+			},
+			pciAddr: "0000:3b:02.0",
+			want:    true,
+		},
+		"iommu disabled": {
+			setup: func(f *fakeSysfs) {
+				f.addPciDevice("0000:3b:02.0", nil)
+			},
+			pciAddr: "0000:3b:02.0",
+		},
+		"no iommu groups": {
+			setup: func(f *fakeSysfs) {
+				f.addPciDevice("0000:3b:02.0", nil)
+				f.mkdir(SysKernelIommuGroups)
+			},
+			pciAddr: "0000:3b:02.0",
+		},
+		"device without iommu group": {
+			setup: func(f *fakeSysfs) {
+				f.addIommuGroup("0000:3b:02.0", 42)
+				f.addPciDevice("0000:3b:02.1", nil)
+			},
+			pciAddr: "0000:3b:02.1",
+		},
+		"missing device": {
+			setup: func(f *fakeSysfs) {
+				f.addIommuGroup("0000:3b:02.0", 42)
+			},
+			pciAddr: "0000:3b:02.7",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			tt.setup(f)
+
+			got, err := IsVfioReady(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("IsVfioReady(%q) = %v, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IsVfioReady(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("IsVfioReady(%q) = %v, want %v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+// newIommuSysfs returns a fake tree with 0000:3b:02.0 and 0000:3b:02.1 in
+// iommu group 42 and 0000:3b:02.2 alone in group 7
+func newIommuSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	f.addIommuGroup("0000:3b:02.1", 42)
+	f.addIommuGroup("0000:3b:02.0", 42)
+	f.addIommuGroup("0000:3b:02.2", 7)
+	return f
+}
+
+func TestGetIOMMUGroup(t *testing.T) {
+	f := newIommuSysfs(t)
+	f.addPciDevice("0000:3b:02.3", nil)
+	f.symlink(f.path("sys", "kernel", "iommu_groups", "bogus"), f.path("sys", "bus", "pci", "devices", "0000:3b:02.4", "iommu_group"))
+
+	tests := map[string]struct {
+		pciAddr string
+		want    int
+		wantErr bool
+	}{
+		"shared group":     {pciAddr: "0000:3b:02.0", want: 42},
+		"own group":        {pciAddr: "0000:3b:02.2", want: 7},
+		"no iommu group":   {pciAddr: "0000:3b:02.3", wantErr: true},
+		"unparsable group": {pciAddr: "0000:3b:02.4", wantErr: true},
+		"missing device":   {pciAddr: "0000:3b:02.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetIOMMUGroup(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetIOMMUGroup(%q) = %d, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetIOMMUGroup(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetIOMMUGroup(%q) = %d, want %d", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListIOMMUGroupDevices(t *testing.T) {
+	newIommuSysfs(t)
+
+	tests := map[string]struct {
+		group   int
+		want    []string
+		wantErr bool
+	}{
+		"shared group":  {group: 42, want: []string{"0000:3b:02.0", "0000:3b:02.1"}},
+		"single device": {group: 7, want: []string{"0000:3b:02.2"}},
+		"missing group": {group: 3, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ListIOMMUGroupDevices(tt.group)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ListIOMMUGroupDevices(%d) = %v, want error", tt.group, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListIOMMUGroupDevices(%d) failed: %v", tt.group, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListIOMMUGroupDevices(%d) = %v, want %v", tt.group, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHostNetDevFromPci(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addNetdev("enp59s0f0v0", "0000:3b:02.0")
+	f.addPciDevice("0000:3b:02.1", nil)
+	f.mkdir(f.path("sys", "bus", "pci", "devices", "0000:3b:02.2", "net"))
+
+	tests := map[string]struct {
+		pciAddr string
+		want    []string
+		wantErr bool
+	}{
+		"populated net dir":  {pciAddr: "0000:3b:02.0", want: []string{"enp59s0f0v0"}},
+		"without net dir":    {pciAddr: "0000:3b:02.1", want: []string{}},
+		"empty net dir":      {pciAddr: "0000:3b:02.2", want: []string{}},
+		"missing PCI device": {pciAddr: "0000:3b:02.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetHostNetDevFromPci(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetHostNetDevFromPci(%q) = %v, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetHostNetDevFromPci(%q) failed: %v", tt.pciAddr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHostNetDevFromPci(%q) = %#v, want %#v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllNetDevsForPci(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addNetdev("enp59s0f0np1", "0000:3b:00.0")
+	f.addNetdev("enp59s0f0np0", "0000:3b:00.0")
+	f.addNetdev("enp59s0f1", "0000:3b:00.1")
+	f.addPciDevice("0000:3b:00.2", nil)
+
+	tests := map[string]struct {
+		pciAddr string
+		want    []string
+		wantErr bool
+	}{
+		"two netdevs":        {pciAddr: "0000:3b:00.0", want: []string{"enp59s0f0np0", "enp59s0f0np1"}},
+		"one netdev":         {pciAddr: "0000:3b:00.1", want: []string{"enp59s0f1"}},
+		"no netdev":          {pciAddr: "0000:3b:00.2", wantErr: true},
+		"missing PCI device": {pciAddr: "0000:3b:00.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetAllNetDevsForPci(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetAllNetDevsForPci(%q) = %v, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAllNetDevsForPci(%q) failed: %v", tt.pciAddr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAllNetDevsForPci(%q) = %v, want %v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDpdkDeviceInfo(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"numa_node": "1\n"})
+	f.bindDriver("0000:3b:02.0", "vfio-pci")
+	f.addPciDevice("0000:3b:02.1", map[string]string{"numa_node": "-1\n"})
+	f.bindDriver("0000:3b:02.1", "igb_uio")
+	f.addPciDevice("0000:3b:02.2", map[string]string{"numa_node": "1\n"})
+	f.bindDriver("0000:3b:02.2", "iavf")
+	f.addPciDevice("0000:3b:02.3", map[string]string{"numa_node": "1\n"})
+	f.addPciDevice("0000:3b:02.4", nil)
+	f.bindDriver("0000:3b:02.4", "vfio-pci")
+
+	tests := map[string]struct {
+		pciAddr string
+		want    DpdkDeviceInfo
+		wantErr bool
+	}{
+		"vfio-pci":           {pciAddr: "0000:3b:02.0", want: DpdkDeviceInfo{PCIAddress: "0000:3b:02.0", Driver: "vfio-pci", NumaNode: 1}},
+		"igb_uio":            {pciAddr: "0000:3b:02.1", want: DpdkDeviceInfo{PCIAddress: "0000:3b:02.1", Driver: "igb_uio", NumaNode: -1}},
+		"kernel driver":      {pciAddr: "0000:3b:02.2", wantErr: true},
+		"unbound":            {pciAddr: "0000:3b:02.3", wantErr: true},
+		"missing NUMA node":  {pciAddr: "0000:3b:02.4", wantErr: true},
+		"missing PCI device": {pciAddr: "0000:3b:02.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetDpdkDeviceInfo(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetDpdkDeviceInfo(%q) = %+v, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDpdkDeviceInfo(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetDpdkDeviceInfo(%q) = %+v, want %+v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictableNameForPci(t *testing.T) {
+	f := newFakeSysfs(t)
+	// dual port PF on bus 0x3b with two VFs on the first port
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0", "0000:3b:02.1")
+	f.addPF("enp59s0f1", "0000:3b:00.1")
+	// single function device on bus 0x5e
+	f.addPciDevice("0000:5e:00.0", nil)
+	// device outside of domain 0
+	f.addPciDevice("0001:af:03.0", nil)
+
+	tests := map[string]struct {
+		pciAddr string
+		want    string
+		wantErr bool
+	}{
+		"first port":         {pciAddr: "0000:3b:00.0", want: "enp59s0f0"},
+		"second port":        {pciAddr: "0000:3b:00.1", want: "enp59s0f1"},
+		"first VF":           {pciAddr: "0000:3b:02.0", want: "enp59s0f0v0"},
+		"second VF":          {pciAddr: "0000:3b:02.1", want: "enp59s0f0v1"},
+		"single function":    {pciAddr: "0000:5e:00.0", want: "enp94s0"},
+		"non-zero domain":    {pciAddr: "0001:af:03.0", want: "enP1p175s3"},
+		"missing PCI device": {pciAddr: "0000:3b:00.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := PredictableNameForPci(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("PredictableNameForPci(%q) = %q, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PredictableNameForPci(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("PredictableNameForPci(%q) = %q, want %q", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictableNameForPciUnlinkedVF(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0")
+	// the VF points at its PF but the PF lost its virtfn link
+	f.remove(filepath.Join(SysBusPci, "0000:3b:00.0", "virtfn0"))
+
+	if got, err := PredictableNameForPci("0000:3b:02.0"); err == nil {
+		t.Errorf("PredictableNameForPci() = %q, want error", got)
+	}
+}
+
+func TestIsPCIDeviceEnabled(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"enable": "1\n"})
+	f.addPciDevice("0000:3b:02.1", map[string]string{"enable": "0\n"})
+	f.addPciDevice("0000:3b:02.2", nil)
+	f.addPciDevice("0000:3b:02.3", map[string]string{"enable": "yes\n"})
+
+	tests := map[string]struct {
+		pciAddr string
+		want    bool
+		wantErr error
+		fail    bool
+	}{
+		"enabled":            {pciAddr: "0000:3b:02.0", want: true},
+		"disabled":           {pciAddr: "0000:3b:02.1", want: false},
+		"missing enable":     {pciAddr: "0000:3b:02.2", fail: true, wantErr: ErrPCIEnableUnavailable},
+		"malformed enable":   {pciAddr: "0000:3b:02.3", fail: true},
+		"missing PCI device": {pciAddr: "0000:3b:02.7", fail: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := IsPCIDeviceEnabled(tt.pciAddr)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("IsPCIDeviceEnabled(%q) = %v, want error", tt.pciAddr, got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("IsPCIDeviceEnabled(%q) error = %v, want %v", tt.pciAddr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IsPCIDeviceEnabled(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("IsPCIDeviceEnabled(%q) = %v, want %v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDriverOverride(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"driver_override": "vfio-pci\n"})
+	f.addPciDevice("0000:3b:02.1", map[string]string{"driver_override": "(null)\n"})
+	f.addPciDevice("0000:3b:02.2", nil)
+
+	tests := map[string]struct {
+		pciAddr string
+		want    string
+		wantErr bool
+	}{
+		"override set":       {pciAddr: "0000:3b:02.0", want: "vfio-pci"},
+		"override unset":     {pciAddr: "0000:3b:02.1", want: ""},
+		"no driver_override": {pciAddr: "0000:3b:02.2", wantErr: true},
+		"missing PCI device": {pciAddr: "0000:3b:02.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetDriverOverride(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetDriverOverride(%q) = %q, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDriverOverride(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetDriverOverride(%q) = %q, want %q", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDriverOverride(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"driver_override": "(null)\n"})
+
+	if err := SetDriverOverride("0000:3b:02.0", "vfio-pci"); err != nil {
+		t.Fatalf("SetDriverOverride() failed: %v", err)
+	}
+	if got, err := GetDriverOverride("0000:3b:02.0"); err != nil || got != "vfio-pci" {
+		t.Errorf("GetDriverOverride() after set = %q, %v, want %q", got, err, "vfio-pci")
+	}
+
+	if err := SetDriverOverride("0000:3b:02.0", ""); err != nil {
+		t.Fatalf("SetDriverOverride() to clear failed: %v", err)
+	}
+	if got, err := GetDriverOverride("0000:3b:02.0"); err != nil || got != "" {
+		t.Errorf("GetDriverOverride() after clear = %q, %v, want empty", got, err)
+	}
+
+	if err := SetDriverOverride("0000:3b:02.7", "vfio-pci"); err == nil {
+		t.Error("SetDriverOverride() succeeded for a missing PCI device, want error")
+	}
+}
+
+func TestGetModalias(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"modalias": "pci:v00008086d0000154Csv00008086sd00000000bc02sc00i00\n"})
+	f.addPciDevice("0000:3b:02.1", nil)
+
+	tests := map[string]struct {
+		pciAddr string
+		want    string
+		wantErr bool
+	}{
+		"modalias":           {pciAddr: "0000:3b:02.0", want: "pci:v00008086d0000154Csv00008086sd00000000bc02sc00i00"},
+		"no modalias":        {pciAddr: "0000:3b:02.1", wantErr: true},
+		"missing PCI device": {pciAddr: "0000:3b:02.7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetModalias(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetModalias(%q) = %q, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetModalias(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetModalias(%q) = %q, want %q", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForDriver(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", nil)
+	f.addPciDevice("0000:3b:02.1", nil)
+	f.bindDriver("0000:3b:02.1", "iavf")
+	f.addPciDevice("0000:3b:02.2", nil)
+
+	// the driver binds to 0000:3b:02.0 asynchronously
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(pollInterval)
+		driverDir := filepath.Join(filepath.Dir(SysBusPci), "drivers", "vfio-pci")
+		if err := os.MkdirAll(driverDir, 0755); err != nil {
+			t.Errorf("failed to create driver: %v", err)
+			return
+		}
+		if err := os.Symlink(driverDir, filepath.Join(SysBusPci, "0000:3b:02.0", "driver")); err != nil {
+			t.Errorf("failed to bind driver: %v", err)
+		}
+	}()
+	err := WaitForDriver("0000:3b:02.0", "vfio-pci", 10*time.Second)
+	<-done
+	if err != nil {
+		t.Errorf("WaitForDriver() failed for a delayed bind: %v", err)
+	}
+
+	// a bind to the wrong driver does not wait for the timeout
+	start := time.Now()
+	if err := WaitForDriver("0000:3b:02.1", "vfio-pci", 10*time.Second); err == nil {
+		t.Error("WaitForDriver() succeeded for a device bound to another driver")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WaitForDriver() took %v for a device bound to another driver", elapsed)
+	}
+
+	if err := WaitForDriver("0000:3b:02.2", "vfio-pci", 0); err == nil {
+		t.Error("WaitForDriver() succeeded for a device that stays unbound")
+	}
+	if err := WaitForDriver("0000:3b:02.7", "vfio-pci", 0); err == nil {
+		t.Error("WaitForDriver() succeeded for a missing PCI device")
+	}
+}
+
+// fakeDriverCore stands in for the kernel driver core of the PCI device
+// pciAddr: writes to an unbind file unbind it and writes to drivers_probe
+// bind it to its driver_override, both taking effect at once
+type fakeDriverCore struct {
+	f       *fakeSysfs
+	pciAddr string
+	// refuse lists the drivers whose probe of the device fails, leaving it
+	// unbound
+	refuse map[string]bool
+	// writeErr, when set, fails the sysfs writes it returns an error for
+	writeErr func(path string) error
+}
+
+// newFakeDriverCore creates the device pciAddr bound to driver and routes
+// the sysfs writes through the returned fake until the test ends
+func newFakeDriverCore(t *testing.T, f *fakeSysfs, pciAddr, driver string) *fakeDriverCore {
+	t.Helper()
+
+	c := &fakeDriverCore{f: f, pciAddr: pciAddr, refuse: map[string]bool{}}
+	f.addPciDevice(pciAddr, map[string]string{"driver_override": "(null)\n"})
+	f.bindDriver(pciAddr, driver)
+	scratch := f.path("written")
+
+	saved := openSysfsFile
+	t.Cleanup(func() { openSysfsFile = saved })
+	openSysfsFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if c.writeErr != nil {
+			if err := c.writeErr(name); err != nil {
+				return nil, &os.PathError{Op: "open", Path: name, Err: err}
+			}
+		}
+		switch {
+		case filepath.Base(name) == "unbind":
+			f.bindDriver(pciAddr, "")
+		case name == filepath.Join(filepath.Dir(SysBusPci), "drivers_probe"):
+			override, err := GetDriverOverride(pciAddr)
+			if err != nil {
+				return nil, err
+			}
+			if override != "" && !c.refuse[override] {
+				f.bindDriver(pciAddr, override)
+			}
+		default:
+			return saved(name, flag, perm)
+		}
+		return saved(scratch, flag|os.O_CREATE, 0644)
+	}
+	return c
+}
+
+// state returns the driver and driver_override of the device
+func (c *fakeDriverCore) state(t *testing.T) (driver, override string) {
+	t.Helper()
+
+	driver, err := GetDriverName(c.pciAddr)
+	if err != nil {
+		t.Fatalf("GetDriverName(%q) failed: %v", c.pciAddr, err)
+	}
+	override, err = GetDriverOverride(c.pciAddr)
+	if err != nil {
+		t.Fatalf("GetDriverOverride(%q) failed: %v", c.pciAddr, err)
+	}
+	return driver, override
+}
+
+func TestSwapDriver(t *testing.T) {
+	f := newFakeSysfs(t)
+	c := newFakeDriverCore(t, f, "0000:3b:02.0", "iavf")
+
+	if err := SwapDriver("0000:3b:02.0", "iavf", "vfio-pci"); err != nil {
+		t.Fatalf("SwapDriver() failed: %v", err)
+	}
+	if driver, override := c.state(t); driver != "vfio-pci" || override != "vfio-pci" {
+		t.Errorf("device bound to %q with override %q, want vfio-pci for both", driver, override)
+	}
+
+	// and back to the kernel driver
+	if err := SwapDriver("0000:3b:02.0", "vfio-pci", "iavf"); err != nil {
+		t.Fatalf("SwapDriver() back failed: %v", err)
+	}
+	if driver, _ := c.state(t); driver != "iavf" {
+		t.Errorf("device bound to %q, want iavf", driver)
+	}
+}
+
+func TestSwapDriverRollback(t *testing.T) {
+	saved := driverBindTimeout
+	t.Cleanup(func() { driverBindTimeout = saved })
+	driverBindTimeout = pollInterval
+
+	tests := map[string]struct {
+		setup           func(c *fakeDriverCore)
+		wantDriver      string
+		wantOverride    string
+		wantIs          error
+		wantRollbackErr bool
+	}{
+		"new driver refuses the device": {
+			setup:      func(c *fakeDriverCore) { c.refuse["vfio-pci"] = true },
+			wantDriver: "iavf",
+		},
+		"unbind fails once": {
+			setup: func(c *fakeDriverCore) {
+				failed := false
+				c.writeErr = func(path string) error {
+					if filepath.Base(path) == "unbind" && !failed {
+						failed = true
+						return syscall.EBUSY
+					}
+					return nil
+				}
+			},
+			wantDriver: "iavf",
+		},
+		"probe fails once": {
+			setup: func(c *fakeDriverCore) {
+				failed := false
+				c.writeErr = func(path string) error {
+					if filepath.Base(path) == "drivers_probe" && !failed {
+						failed = true
+						return syscall.ENODEV
+					}
+					return nil
+				}
+			},
+			// the device was unbound before the probe failed
+			wantDriver: "iavf",
+		},
+		"rollback fails too": {
+			setup: func(c *fakeDriverCore) {
+				c.refuse["vfio-pci"] = true
+				c.refuse["iavf"] = true
+			},
+			wantDriver:      "",
+			wantRollbackErr: true,
+		},
+		"read-only sysfs": {
+			setup: func(c *fakeDriverCore) {
+				c.writeErr = func(string) error { return syscall.EROFS }
+			},
+			// nothing was changed, but the rollback cannot write either
+			wantDriver:      "iavf",
+			wantIs:          ErrSysfsReadOnly,
+			wantRollbackErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			c := newFakeDriverCore(t, f, "0000:3b:02.0", "iavf")
+			tt.setup(c)
+
+			err := SwapDriver("0000:3b:02.0", "iavf", "vfio-pci")
+			if err == nil {
+				t.Fatal("SwapDriver() succeeded, want error")
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("SwapDriver() error = %v, want %v", err, tt.wantIs)
+			}
+			if got := strings.Contains(err.Error(), "failed to roll back"); got != tt.wantRollbackErr {
+				t.Errorf("SwapDriver() error = %v, want rollback failure reported %v", err, tt.wantRollbackErr)
+			}
+			c.writeErr = nil
+			driver, override := c.state(t)
+			if driver != tt.wantDriver || override != tt.wantOverride {
+				t.Errorf("device bound to %q with override %q, want %q and %q",
+					driver, override, tt.wantDriver, tt.wantOverride)
+			}
+		})
+	}
+}
+
+func TestSwapDriverPreconditions(t *testing.T) {
+	f := newFakeSysfs(t)
+	c := newFakeDriverCore(t, f, "0000:3b:02.0", "iavf")
+	writes := 0
+	c.writeErr = func(string) error {
+		writes++
+		return nil
+	}
+
+	tests := map[string]struct {
+		pciAddr              string
+		fromDriver, toDriver string
+		wantErr              bool
+	}{
+		"bound to another driver": {pciAddr: "0000:3b:02.0", fromDriver: "mlx5_core", toDriver: "vfio-pci", wantErr: true},
+		"missing device":          {pciAddr: "0000:3b:02.7", fromDriver: "iavf", toDriver: "vfio-pci", wantErr: true},
+		"already on the driver":   {pciAddr: "0000:3b:02.0", fromDriver: "iavf", toDriver: "iavf"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := SwapDriver(tt.pciAddr, tt.fromDriver, tt.toDriver)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("SwapDriver(%q, %q, %q) error = %v, want error %v",
+					tt.pciAddr, tt.fromDriver, tt.toDriver, err, tt.wantErr)
+			}
+		})
+	}
+	if writes != 0 {
+		t.Errorf("SwapDriver() wrote sysfs %d times, want none", writes)
+	}
+	if driver, _ := c.state(t); driver != "iavf" {
+		t.Errorf("device bound to %q, want iavf", driver)
+	}
+}
+
+func TestVFOnNumaNode(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"numa_node": "1\n"})
+	f.addPciDevice("0000:3b:02.1", map[string]string{"numa_node": "-1\n"})
+	f.addPciDevice("0000:3b:02.2", map[string]string{"numa_node": "x\n"})
+
+	tests := map[string]struct {
+		vfPci   string
+		node    int
+		want    bool
+		wantErr bool
+	}{
+		"matching node":        {vfPci: "0000:3b:02.0", node: 1, want: true},
+		"other node":           {vfPci: "0000:3b:02.0", node: 0},
+		"no affinity":          {vfPci: "0000:3b:02.1", node: 0, want: true},
+		"no affinity any node": {vfPci: "0000:3b:02.1", node: 3, want: true},
+		"malformed numa_node":  {vfPci: "0000:3b:02.2", node: 0, wantErr: true},
+		"missing PCI device":   {vfPci: "0000:3b:02.3", node: 0, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := VFOnNumaNode(tt.vfPci, tt.node)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("VFOnNumaNode(%q, %d) = %v, want error", tt.vfPci, tt.node, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VFOnNumaNode(%q, %d) failed: %v", tt.vfPci, tt.node, err)
+			}
+			if got != tt.want {
+				t.Errorf("VFOnNumaNode(%q, %d) = %v, want %v", tt.vfPci, tt.node, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVFLinkNamesWait(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0")
+	f.bindDriver("0000:3b:02.0", "iavf")
+
+	// the VF netdev registers shortly after the VF was created
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		f.addNetdev("enp59s0f0v0", "0000:3b:02.0")
+	}()
+
+	got, err := GetVFLinkNamesWait("0000:3b:02.0", 5*time.Second)
+	if err != nil {
+		t.Fatalf("GetVFLinkNamesWait() failed: %v", err)
+	}
+	if want := []string{"enp59s0f0v0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetVFLinkNamesWait() = %v, want %v", got, want)
+	}
+}
+
+func TestGetVFLinkNamesWaitNoNetdev(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0", "0000:3b:02.1")
+	f.bindDriver("0000:3b:02.0", "iavf")
+	f.bindDriver("0000:3b:02.1", "vfio-pci")
+
+	tests := map[string]struct {
+		pciAddr  string
+		timeout  time.Duration
+		want     []string
+		wantErr  bool
+		maxDelay time.Duration
+	}{
+		"netdev never registers": {pciAddr: "0000:3b:02.0", timeout: 200 * time.Millisecond, wantErr: true, maxDelay: 2 * time.Second},
+		"userspace driver":       {pciAddr: "0000:3b:02.1", timeout: time.Hour, want: []string{}, maxDelay: time.Second},
+		"missing PCI device":     {pciAddr: "0000:3b:02.2", timeout: time.Hour, wantErr: true, maxDelay: time.Second},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			got, err := GetVFLinkNamesWait(tt.pciAddr, tt.timeout)
+			if elapsed := time.Since(start); elapsed > tt.maxDelay {
+				t.Errorf("GetVFLinkNamesWait(%q) took %v, want at most %v", tt.pciAddr, elapsed, tt.maxDelay)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetVFLinkNamesWait(%q) = %v, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVFLinkNamesWait(%q) failed: %v", tt.pciAddr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetVFLinkNamesWait(%q) = %v, want %v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePCIAddress(t *testing.T) {
+	tests := map[string]struct {
+		addr                 string
+		domain, bus, dev, fn int
+		wantErr              bool
+	}{
+		"full form":             {addr: "0000:3b:02.1", bus: 0x3b, dev: 0x02, fn: 1},
+		"upper case":            {addr: "0000:AF:1F.7", bus: 0xaf, dev: 0x1f, fn: 7},
+		"short form":            {addr: "3b:02.1", bus: 0x3b, dev: 0x02, fn: 1},
+		"non zero domain":       {addr: "0001:af:00.0", domain: 1, bus: 0xaf},
+		"VMD domain":            {addr: "10000:e1:00.0", domain: 0x10000, bus: 0xe1},
+		"Hyper-V domain":        {addr: "c2d1a1b3:00:02.0", domain: 0xc2d1a1b3, dev: 0x02},
+		"domain too long":       {addr: "123456789:00:02.0", wantErr: true},
+		"domain too short":      {addr: "000:3b:02.1", wantErr: true},
+		"device out of range":   {addr: "0000:3b:20.0", wantErr: true},
+		"function out of range": {addr: "0000:3b:02.8", wantErr: true},
+		"missing function":      {addr: "0000:3b:02", wantErr: true},
+		"not hex":               {addr: "0000:3g:02.1", wantErr: true},
+		"trailing garbage":      {addr: "0000:3b:02.1 ", wantErr: true},
+		"empty":                 {addr: "", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			domain, bus, dev, fn, err := ParsePCIAddress(tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePCIAddress(%q) = %x, %x, %x, %x, want error", tt.addr, domain, bus, dev, fn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePCIAddress(%q) failed: %v", tt.addr, err)
+			}
+			if domain != tt.domain || bus != tt.bus || dev != tt.dev || fn != tt.fn {
+				t.Errorf("ParsePCIAddress(%q) = %x, %x, %x, %x, want %x, %x, %x, %x", tt.addr, domain, bus, dev, fn, tt.domain, tt.bus, tt.dev, tt.fn)
+			}
+		})
+	}
+}
+
+func TestIsNetworkDevice(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:00.0", map[string]string{"class": "0x020000\n"})
+	f.addPciDevice("0000:3b:02.0", map[string]string{"class": "0x020000\n"})
+	f.addPciDevice("0000:af:00.0", map[string]string{"class": "0x028000\n"})
+	f.addPciDevice("0000:5e:00.0", map[string]string{"class": "0x030200\n"})
+	f.addPciDevice("0000:01:00.0", map[string]string{"class": "0x010802\n"})
+	f.addPciDevice("0000:02:00.0", map[string]string{"class": "0x0c0330\n"})
+	f.addPciDevice("0000:03:00.0", map[string]string{"class": "not-a-class\n"})
+
+	tests := map[string]struct {
+		pciAddr string
+		want    bool
+		wantErr bool
+	}{
+		"ethernet controller": {pciAddr: "0000:3b:00.0", want: true},
+		"ethernet VF":         {pciAddr: "0000:3b:02.0", want: true},
+		"other network class": {pciAddr: "0000:af:00.0", want: true},
+		"GPU":                 {pciAddr: "0000:5e:00.0"},
+		"NVMe controller":     {pciAddr: "0000:01:00.0"},
+		"USB controller":      {pciAddr: "0000:02:00.0"},
+		"malformed class":     {pciAddr: "0000:03:00.0", wantErr: true},
+		"missing PCI device":  {pciAddr: "0000:04:00.0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := IsNetworkDevice(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("IsNetworkDevice(%q) = %v, want error", tt.pciAddr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IsNetworkDevice(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("IsNetworkDevice(%q) = %v, want %v", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Representor naming schemes, as seen in the phys_port_name of VF
+// representors across kernel versions and vendors
+const (
+	// RepresentorSchemePfVf is the pf<N>vf<M> scheme
+	RepresentorSchemePfVf = "pfNvfM"
+	// RepresentorSchemeControllerPfVf is the c<C>pf<N>vf<M> scheme used by
+	// multi-host/external controller setups
+	RepresentorSchemeControllerPfVf = "cCpfNvfM"
+	// RepresentorSchemeLegacy is the older scheme where phys_port_name is the
+	// bare VF index and the netdev is named like <pf>_<M>
+	RepresentorSchemeLegacy = "M"
+)
+
+// RepresentorInfo describes a VF representor netdev
+type RepresentorInfo struct {
+	Name    string `json:"name"`
+	VFIndex int    `json:"vfIndex"`
+}
+
+var (
+	pfVfPortRe           = regexp.MustCompile(`^pf(\d+)vf(\d+)$`)
+	controllerPfVfPortRe = regexp.MustCompile(`^c(\d+)pf(\d+)vf(\d+)$`)
+	legacyVfPortRe       = regexp.MustCompile(`^(\d+)$`)
+	uplinkPortRe         = regexp.MustCompile(`^p(\d+)$`)
+)
+
+// readSwitchAttr reads a switchdev attribute of ifName, returning an empty
+// string when the device does not implement it
+func readSwitchAttr(ifName, attr string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(NetDirectory, ifName, attr))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s of %q: %w", attr, ifName, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// getSwitchSiblings returns the netdevs, other than ifName, sharing the
+// phys_switch_id of ifName, sorted by name
+func getSwitchSiblings(ifName string) ([]string, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return nil, err
+	}
+
+	switchID, err := readSwitchAttr(ifName, "phys_switch_id")
+	if err != nil {
+		return nil, err
+	}
+	if switchID == "" {
+		return nil, fmt.Errorf("interface %q has no switch id, is the device in switchdev mode?", ifName)
+	}
+
+	netDevs, err := getFileNamesFromPath(NetDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := []string{}
+	for _, netDev := range netDevs {
+		if netDev == ifName {
+			continue
+		}
+		devSwitchID, err := readSwitchAttr(netDev, "phys_switch_id")
+		if err != nil || devSwitchID != switchID {
+			continue
+		}
+		siblings = append(siblings, netDev)
+	}
+	sort.Strings(siblings)
+	return siblings, nil
+}
+
+// representorScheme returns the naming scheme a VF representor port name
+// follows, or an empty string when portName is not a VF representor
+func representorScheme(portName string) string {
+	switch {
+	case pfVfPortRe.MatchString(portName):
+		return RepresentorSchemePfVf
+	case controllerPfVfPortRe.MatchString(portName):
+		return RepresentorSchemeControllerPfVf
+	case legacyVfPortRe.MatchString(portName):
+		return RepresentorSchemeLegacy
+	}
+	return ""
+}
+
+// DetectRepresentorScheme infers the VF representor naming scheme in use for
+// pfName from the phys_port_name of its existing representors
+func DetectRepresentorScheme(pfName string) (string, error) {
+	siblings, err := getSwitchSiblings(pfName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, sibling := range siblings {
+		portName, err := readSwitchAttr(sibling, "phys_port_name")
+		if err != nil {
+			return "", err
+		}
+		if scheme := representorScheme(portName); scheme != "" {
+			return scheme, nil
+		}
+	}
+	return "", fmt.Errorf("no VF representors found for PF %q", pfName)
+}
+
+// IsRepresentor reports whether ifName is a VF representor, i.e. its
+// phys_port_name follows a VF representor scheme and it shares its
+// phys_switch_id with a netdev that is not a VF representor (the PF)
+func IsRepresentor(ifName string) (bool, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(filepath.Join(NetDirectory, ifName)); err != nil {
+		return false, fmt.Errorf("failed to find interface %q: %w", ifName, err)
+	}
+
+	portName, err := readSwitchAttr(ifName, "phys_port_name")
+	if err != nil {
+		return false, err
+	}
+	if representorScheme(portName) == "" {
+		return false, nil
+	}
+
+	switchID, err := readSwitchAttr(ifName, "phys_switch_id")
+	if err != nil || switchID == "" {
+		return false, err
+	}
+
+	siblings, err := getSwitchSiblings(ifName)
+	if err != nil {
+		return false, err
+	}
+	for _, sibling := range siblings {
+		siblingPort, err := readSwitchAttr(sibling, "phys_port_name")
+		if err != nil {
+			return false, err
+		}
+		if representorScheme(siblingPort) == "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetPFFromRepresentor returns the PF (uplink) netdev owning the VF
+// representor reprIfName, found among the netdevs sharing its switch id
+func GetPFFromRepresentor(reprIfName string) (string, error) {
+	siblings, err := getSwitchSiblings(reprIfName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, sibling := range siblings {
+		portName, err := readSwitchAttr(sibling, "phys_port_name")
+		if err != nil {
+			return "", err
+		}
+		if uplinkPortRe.MatchString(portName) {
+			return sibling, nil
+		}
+	}
+	return "", fmt.Errorf("no PF found for representor %q", reprIfName)
+}
+
+// representorVFIndex returns the VF index encoded in a VF representor port
+// name, or -1 when portName is not a VF representor
+func representorVFIndex(portName string) int {
+	var index string
+	if m := pfVfPortRe.FindStringSubmatch(portName); m != nil {
+		index = m[2]
+	} else if m := controllerPfVfPortRe.FindStringSubmatch(portName); m != nil {
+		index = m[3]
+	} else if m := legacyVfPortRe.FindStringSubmatch(portName); m != nil {
+		index = m[1]
+	} else {
+		return -1
+	}
+
+	vfIndex, err := strconv.Atoi(index)
+	if err != nil {
+		return -1
+	}
+	return vfIndex
+}
+
+// ListRepresentors returns the VF representors of pfName, found among the
+// netdevs sharing its switch id, sorted by VF index
+func ListRepresentors(pfName string) ([]RepresentorInfo, error) {
+	siblings, err := getSwitchSiblings(pfName)
+	if err != nil {
+		return nil, err
+	}
+
+	representors := []RepresentorInfo{}
+	for _, sibling := range siblings {
+		portName, err := readSwitchAttr(sibling, "phys_port_name")
+		if err != nil {
+			return nil, err
+		}
+		if vfIndex := representorVFIndex(portName); vfIndex >= 0 {
+			representors = append(representors, RepresentorInfo{Name: sibling, VFIndex: vfIndex})
+		}
+	}
+
+	sort.Slice(representors, func(i, j int) bool {
+		return representors[i].VFIndex < representors[j].VFIndex
+	})
+	return representors, nil
+}
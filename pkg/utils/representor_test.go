@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// addSwitchdevNetdev creates the netdev ifName as a port of the eswitch
+// switchID with the given phys_port_name
+func (f *fakeSysfs) addSwitchdevNetdev(ifName, switchID, portName string) {
+	f.t.Helper()
+	ifDir := f.addNetdev(ifName, "")
+	f.writeFile(filepath.Join(ifDir, "phys_switch_id"), switchID+"\n")
+	f.writeFile(filepath.Join(ifDir, "phys_port_name"), portName+"\n")
+}
+
+func TestDetectRepresentorScheme(t *testing.T) {
+	tests := map[string]struct {
+		setup   func(f *fakeSysfs)
+		want    string
+		wantErr bool
+	}{
+		"pfNvfM": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+				f.addSwitchdevNetdev("enp59s0f0_0", "aabbcc", "pf0vf0")
+				f.addSwitchdevNetdev("enp59s0f0_1", "aabbcc", "pf0vf1")
+			},
+			want: RepresentorSchemePfVf,
+		},
+		"cCpfNvfM": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+				f.addSwitchdevNetdev("eth2", "aabbcc", "c1pf0vf2")
+			},
+			want: RepresentorSchemeControllerPfVf,
+		},
+		"legacy": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "")
+				f.addSwitchdevNetdev("eth0_0", "aabbcc", "0")
+				f.addSwitchdevNetdev("eth0_1", "aabbcc", "1")
+			},
+			want: RepresentorSchemeLegacy,
+		},
+		"representors of another eswitch": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+				f.addSwitchdevNetdev("enp94s0f0", "ddeeff", "p0")
+				f.addSwitchdevNetdev("enp94s0f0_0", "ddeeff", "pf0vf0")
+			},
+			wantErr: true,
+		},
+		"no switch id": {
+			setup: func(f *fakeSysfs) {
+				f.addNetdev("enp59s0f0", "0000:3b:00.0")
+			},
+			wantErr: true,
+		},
+		"missing PF": {
+			setup:   func(f *fakeSysfs) {},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			tt.setup(f)
+
+			got, err := DetectRepresentorScheme("enp59s0f0")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("DetectRepresentorScheme() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetectRepresentorScheme() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DetectRepresentorScheme() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newSwitchdevSysfs returns a fake tree with the switchdev PF enp59s0f0, its
+// VF representors enp59s0f0_0 and enp59s0f0_1, the real VF netdev
+// enp59s0f0v0, the legacy NIC eno1 and a representor eth9 whose eswitch has
+// no uplink
+func newSwitchdevSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0")
+	f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+	f.addSwitchdevNetdev("enp59s0f0_1", "aabbcc", "pf0vf1")
+	f.addSwitchdevNetdev("enp59s0f0_0", "aabbcc", "pf0vf0")
+	f.addNetdev("enp59s0f0v0", "0000:3b:02.0")
+	f.addNetdev("eno1", "0000:01:00.0")
+	f.addSwitchdevNetdev("eth9", "ddeeff", "pf0vf0")
+	return f
+}
+
+func TestIsRepresentor(t *testing.T) {
+	newSwitchdevSysfs(t)
+
+	tests := map[string]struct {
+		ifName  string
+		want    bool
+		wantErr bool
+	}{
+		"representor":        {ifName: "enp59s0f0_0", want: true},
+		"real VF":            {ifName: "enp59s0f0v0", want: false},
+		"switchdev PF":       {ifName: "enp59s0f0", want: false},
+		"legacy NIC":         {ifName: "eno1", want: false},
+		"eswitch without PF": {ifName: "eth9", want: false},
+		"missing interface":  {ifName: "enp59s0f0_7", wantErr: true},
+		"invalid name":       {ifName: "../enp59s0f0_0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := IsRepresentor(tt.ifName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("IsRepresentor(%q) = %v, want error", tt.ifName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IsRepresentor(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRepresentor(%q) = %v, want %v", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPFFromRepresentor(t *testing.T) {
+	newSwitchdevSysfs(t)
+
+	tests := map[string]struct {
+		reprIfName string
+		want       string
+		wantErr    bool
+	}{
+		"first representor":  {reprIfName: "enp59s0f0_0", want: "enp59s0f0"},
+		"second representor": {reprIfName: "enp59s0f0_1", want: "enp59s0f0"},
+		"eswitch without PF": {reprIfName: "eth9", wantErr: true},
+		"no switch id":       {reprIfName: "enp59s0f0v0", wantErr: true},
+		"missing interface":  {reprIfName: "enp59s0f0_7", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetPFFromRepresentor(tt.reprIfName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetPFFromRepresentor(%q) = %q, want error", tt.reprIfName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPFFromRepresentor(%q) failed: %v", tt.reprIfName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetPFFromRepresentor(%q) = %q, want %q", tt.reprIfName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRepresentors(t *testing.T) {
+	tests := map[string]struct {
+		setup   func(f *fakeSysfs)
+		want    []RepresentorInfo
+		wantErr bool
+	}{
+		"sorted by VF index": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+				f.addSwitchdevNetdev("enp59s0f0_10", "aabbcc", "pf0vf10")
+				f.addSwitchdevNetdev("enp59s0f0_2", "aabbcc", "pf0vf2")
+				f.addSwitchdevNetdev("enp59s0f0_0", "aabbcc", "pf0vf0")
+				f.addSwitchdevNetdev("enp59s0f0_1", "aabbcc", "pf0vf1")
+			},
+			want: []RepresentorInfo{
+				{Name: "enp59s0f0_0", VFIndex: 0},
+				{Name: "enp59s0f0_1", VFIndex: 1},
+				{Name: "enp59s0f0_2", VFIndex: 2},
+				{Name: "enp59s0f0_10", VFIndex: 10},
+			},
+		},
+		"controller scheme": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+				f.addSwitchdevNetdev("eth3", "aabbcc", "c1pf0vf3")
+				f.addSwitchdevNetdev("eth1", "aabbcc", "c1pf0vf1")
+			},
+			want: []RepresentorInfo{
+				{Name: "eth1", VFIndex: 1},
+				{Name: "eth3", VFIndex: 3},
+			},
+		},
+		"legacy scheme": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "")
+				f.addSwitchdevNetdev("eth0_1", "aabbcc", "1")
+				f.addSwitchdevNetdev("eth0_0", "aabbcc", "0")
+			},
+			want: []RepresentorInfo{
+				{Name: "eth0_0", VFIndex: 0},
+				{Name: "eth0_1", VFIndex: 1},
+			},
+		},
+		"other ports and eswitches skipped": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+				f.addSwitchdevNetdev("enp59s0f0_0", "aabbcc", "pf0vf0")
+				f.addSwitchdevNetdev("enp59s0f0pf0sf1", "aabbcc", "pf0sf1")
+				f.addSwitchdevNetdev("enp94s0f0", "ddeeff", "p0")
+				f.addSwitchdevNetdev("enp94s0f0_0", "ddeeff", "pf0vf0")
+				f.addNetdev("eno1", "0000:01:00.0")
+			},
+			want: []RepresentorInfo{
+				{Name: "enp59s0f0_0", VFIndex: 0},
+			},
+		},
+		"no representors": {
+			setup: func(f *fakeSysfs) {
+				f.addSwitchdevNetdev("enp59s0f0", "aabbcc", "p0")
+			},
+			want: []RepresentorInfo{},
+		},
+		"no switch id": {
+			setup: func(f *fakeSysfs) {
+				f.addNetdev("enp59s0f0", "0000:3b:00.0")
+			},
+			wantErr: true,
+		},
+		"missing PF": {
+			setup:   func(f *fakeSysfs) {},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			tt.setup(f)
+
+			got, err := ListRepresentors("enp59s0f0")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ListRepresentors() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListRepresentors() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListRepresentors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
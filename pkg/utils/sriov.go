@@ -0,0 +1,709 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// readSriovAttr reads an integer SR-IOV attribute of the PF netdev ifName
+func readSriovAttr(ifName, attr string) (int, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return 0, err
+	}
+
+	attrFile := filepath.Join(NetDirectory, ifName, "device", attr)
+	data, err := os.ReadFile(attrFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %q: %w", attrFile, err)
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %w", attrFile, err)
+	}
+	return value, nil
+}
+
+// GetSriovNumVfs returns the number of VFs configured on the PF ifName
+func GetSriovNumVfs(ifName string) (int, error) {
+	return readSriovAttr(ifName, "sriov_numvfs")
+}
+
+// SupportsSriov reports whether the PF ifName is SR-IOV capable, whether or
+// not VFs are currently enabled. NICs without SR-IOV return false.
+func SupportsSriov(ifName string) (bool, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(filepath.Join(NetDirectory, ifName)); err != nil {
+		return false, fmt.Errorf("failed to find interface %q: %w", ifName, err)
+	}
+
+	totalVfs, err := readSriovAttr(ifName, "sriov_totalvfs")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return totalVfs > 0, nil
+}
+
+// EnsureNumVfs checks that the PF ifName has the expected number of VFs
+// configured, catching SR-IOV reconfiguration done out of band
+func EnsureNumVfs(ifName string, expected int) error {
+	numVfs, err := GetSriovNumVfs(ifName)
+	if err != nil {
+		return err
+	}
+	if numVfs != expected {
+		return fmt.Errorf("PF %q has %d VFs configured, expected %d", ifName, numVfs, expected)
+	}
+	return nil
+}
+
+// ErrNotVF is returned when a VF only operation is given a PCI device that is
+// not a VF
+var ErrNotVF = errors.New("PCI device is not a VF")
+
+// GetPfName returns the name of the PF netdev of the VF at pciAddr
+func GetPfName(pciAddr string) (string, error) {
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr)); err != nil {
+		return "", fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	physfn := filepath.Join(SysBusPci, pciAddr, "physfn")
+	if _, err := os.Lstat(physfn); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%q: %w", pciAddr, ErrNotVF)
+		}
+		return "", fmt.Errorf("failed to read physfn of %q: %w", pciAddr, err)
+	}
+
+	pfNetDevs, err := getFileNamesFromPath(filepath.Join(physfn, "net"))
+	if err != nil {
+		return "", fmt.Errorf("failed to find PF net device of %q: %w", pciAddr, err)
+	}
+	if len(pfNetDevs) == 0 {
+		return "", fmt.Errorf("PF of %q has no net device", pciAddr)
+	}
+	return pfNetDevs[0], nil
+}
+
+// GetPfNameOrPci returns the name of the PF netdev of the VF at pciAddr,
+// like GetPfName. A PF without a netdev, e.g. one bound to a userspace
+// driver, is identified by its PCI address instead and hasNetdev is false.
+func GetPfNameOrPci(pciAddr string) (pf string, hasNetdev bool, err error) {
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr)); err != nil {
+		return "", false, fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	pfDir, err := filepath.EvalSymlinks(filepath.Join(SysBusPci, pciAddr, "physfn"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, fmt.Errorf("%q: %w", pciAddr, ErrNotVF)
+		}
+		return "", false, fmt.Errorf("failed to resolve physfn of %q: %w", pciAddr, err)
+	}
+
+	pfPci := filepath.Base(pfDir)
+	pfNetDevs, err := GetHostNetDevFromPci(pfPci)
+	if err != nil {
+		return "", false, err
+	}
+	if len(pfNetDevs) == 0 {
+		return pfPci, false, nil
+	}
+	return pfNetDevs[0], true, nil
+}
+
+// GetPciAddress returns the PCI address of VF vfID of the PF ifName
+func GetPciAddress(ifName string, vfID int) (string, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return "", err
+	}
+
+	vfLink, err := os.Readlink(filepath.Join(NetDirectory, ifName, "device", fmt.Sprintf("virtfn%d", vfID)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read PCI address of VF %d on %q: %w", vfID, ifName, err)
+	}
+	return filepath.Base(vfLink), nil
+}
+
+// ErrSriovNotEnabled is returned when a PF has no VFs configured
+var ErrSriovNotEnabled = errors.New("SR-IOV is not enabled")
+
+// ErrVFNotOnPF is returned when a VF is looked up on a PF it does not belong
+// to
+var ErrVFNotOnPF = errors.New("VF does not belong to PF")
+
+// GetVfid returns the ID of the VF at pciAddr on the PF pfName
+func GetVfid(pciAddr, pfName string) (int, error) {
+	numVfs, err := GetSriovNumVfs(pfName)
+	if err != nil {
+		return -1, err
+	}
+	if numVfs == 0 {
+		return -1, fmt.Errorf("PF %q has sriov_numvfs set to 0: %w", pfName, ErrSriovNotEnabled)
+	}
+
+	// the physfn link of the VF names its PF without scanning every virtfn
+	vfPfName, err := GetPfName(pciAddr)
+	if err != nil {
+		return -1, err
+	}
+	if vfPfName != pfName {
+		return -1, fmt.Errorf("VF %q belongs to PF %q, not %q: %w", pciAddr, vfPfName, pfName, ErrVFNotOnPF)
+	}
+
+	for vfID := 0; vfID < numVfs; vfID++ {
+		vfLink, err := os.Readlink(filepath.Join(NetDirectory, pfName, "device", fmt.Sprintf("virtfn%d", vfID)))
+		if err != nil {
+			continue
+		}
+		if filepath.Base(vfLink) == pciAddr {
+			return vfID, nil
+		}
+	}
+	return -1, fmt.Errorf("unable to get VF ID with PF: %s and VF pci address %v", pfName, pciAddr)
+}
+
+// GetVFIDFromNetdev returns the VF ID and the PF netdev name of the VF netdev
+// ifName
+func GetVFIDFromNetdev(ifName string) (int, string, error) {
+	pciAddr, err := netdevPciAddress(ifName)
+	if err != nil {
+		return -1, "", err
+	}
+
+	pfName, err := GetPfName(pciAddr)
+	if err != nil {
+		return -1, "", err
+	}
+
+	vfID, err := GetVfid(pciAddr, pfName)
+	if err != nil {
+		return -1, "", err
+	}
+	return vfID, pfName, nil
+}
+
+// GetPFNetdevFromVFNetdev returns the name of the PF netdev of the VF netdev
+// vfIfName. A netdev that is not backed by a VF fails with ErrNotVF.
+func GetPFNetdevFromVFNetdev(vfIfName string) (string, error) {
+	pciAddr, err := netdevPciAddress(vfIfName)
+	if err != nil {
+		return "", err
+	}
+
+	pfName, err := GetPfName(pciAddr)
+	if err != nil {
+		return "", fmt.Errorf("failed to find PF netdev of %q: %w", vfIfName, err)
+	}
+	return pfName, nil
+}
+
+// GetVFCountByPCI returns the number of VFs configured on the PF at the given
+// PCI address
+func GetVFCountByPCI(pciAddr string) (int, error) {
+	return readPciSriovAttr(pciAddr, "sriov_numvfs")
+}
+
+// readPciSriovAttr reads an integer SR-IOV attribute of the PF at pciAddr
+func readPciSriovAttr(pciAddr, attr string) (int, error) {
+	attrFile := filepath.Join(SysBusPci, pciAddr, attr)
+	data, err := os.ReadFile(attrFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %q: %w", attrFile, err)
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %w", attrFile, err)
+	}
+	return value, nil
+}
+
+// GetSriovOffsetStride returns the routing ID offset of the first VF and the
+// stride between consecutive VFs of the PF at pfPci
+func GetSriovOffsetStride(pfPci string) (offset, stride int, err error) {
+	if offset, err = readPciSriovAttr(pfPci, "sriov_offset"); err != nil {
+		return 0, 0, err
+	}
+	if stride, err = readPciSriovAttr(pfPci, "sriov_stride"); err != nil {
+		return 0, 0, err
+	}
+	return offset, stride, nil
+}
+
+// IsPFWithVFs reports whether the PCI address is an SR-IOV PF and how many
+// VFs it has configured. A device that is not a PF is not an error.
+func IsPFWithVFs(pciAddr string) (bool, int, error) {
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr)); err != nil {
+		return false, 0, fmt.Errorf("failed to find PCI device %q: %w", pciAddr, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(SysBusPci, pciAddr, "sriov_numvfs")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, 0, nil
+		}
+		return false, 0, fmt.Errorf("failed to check SR-IOV capability of %q: %w", pciAddr, err)
+	}
+
+	numVfs, err := GetVFCountByPCI(pciAddr)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, numVfs, nil
+}
+
+// arphrdInfiniband is the link type of InfiniBand netdevs
+const arphrdInfiniband = 32
+
+// ErrNotInfiniband is returned for InfiniBand only operations on other
+// devices
+var ErrNotInfiniband = errors.New("not an InfiniBand device")
+
+// checkInfiniband returns ErrNotInfiniband when pfName is not an InfiniBand
+// netdev
+func checkInfiniband(pfName string) error {
+	if err := ValidateInterfaceName(pfName); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(NetDirectory, pfName, "type"))
+	if err != nil {
+		return fmt.Errorf("failed to read link type of %q: %w", pfName, err)
+	}
+	linkType, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("failed to parse link type of %q: %w", pfName, err)
+	}
+	if linkType != arphrdInfiniband {
+		return fmt.Errorf("PF %q: %w", pfName, ErrNotInfiniband)
+	}
+	return nil
+}
+
+// vfGUIDFile returns the sysfs file holding the node or port GUID of VF
+// vfID on the InfiniBand PF pfName
+func vfGUIDFile(pfName string, vfID int, kind string) (string, error) {
+	if err := checkInfiniband(pfName); err != nil {
+		return "", err
+	}
+	return filepath.Join(NetDirectory, pfName, "device", "sriov", strconv.Itoa(vfID), kind), nil
+}
+
+// GetVFGUID returns the node and port GUIDs of VF vfID on the InfiniBand PF
+// pfName
+func GetVFGUID(pfName string, vfID int) (node, port string, err error) {
+	nodeFile, err := vfGUIDFile(pfName, vfID, "node")
+	if err != nil {
+		return "", "", err
+	}
+	portFile, err := vfGUIDFile(pfName, vfID, "port")
+	if err != nil {
+		return "", "", err
+	}
+
+	nodeData, err := os.ReadFile(nodeFile)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read node GUID of VF %d on %q: %w", vfID, pfName, err)
+	}
+	portData, err := os.ReadFile(portFile)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read port GUID of VF %d on %q: %w", vfID, pfName, err)
+	}
+	return strings.TrimSpace(string(nodeData)), strings.TrimSpace(string(portData)), nil
+}
+
+// setVFGUID validates guid and writes it as the node or port GUID of VF vfID
+func setVFGUID(pfName string, vfID int, kind, guid string) error {
+	hwAddr, err := net.ParseMAC(guid)
+	if err != nil || len(hwAddr) != 8 {
+		return fmt.Errorf("invalid %s GUID %q", kind, guid)
+	}
+
+	guidFile, err := vfGUIDFile(pfName, vfID, kind)
+	if err != nil {
+		return err
+	}
+	return writeSysfsFile(guidFile, hwAddr.String())
+}
+
+// SetVFNodeGUID sets the node GUID of VF vfID on the InfiniBand PF pfName
+func SetVFNodeGUID(pfName string, vfID int, guid string) error {
+	return setVFGUID(pfName, vfID, "node", guid)
+}
+
+// SetVFPortGUID sets the port GUID of VF vfID on the InfiniBand PF pfName
+func SetVFPortGUID(pfName string, vfID int, guid string) error {
+	return setVFGUID(pfName, vfID, "port", guid)
+}
+
+// parseSysfsBool parses the boolean spellings used by vendor sriov sysfs
+// files
+func parseSysfsBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "1", "true", "enabled", "yes":
+		return true, nil
+	case "off", "0", "false", "disabled", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value %q", value)
+}
+
+// parseSysfsLinkState maps a vendor sriov sysfs link state to the netlink
+// IFLA_VF_LINK_STATE value
+func parseSysfsLinkState(value string) (uint32, error) {
+	switch strings.ToLower(value) {
+	case "auto", "follow":
+		return netlink.VF_LINK_STATE_AUTO, nil
+	case "enable", "up":
+		return netlink.VF_LINK_STATE_ENABLE, nil
+	case "disable", "down":
+		return netlink.VF_LINK_STATE_DISABLE, nil
+	}
+	return 0, fmt.Errorf("invalid link state %q", value)
+}
+
+// setVFConfigField parses value into the VFConfig field named by key, the
+// keys being the sysfs file names (or config labels) used by vendors.
+// Unknown keys are ignored.
+func setVFConfigField(cfg *VFConfig, key, value string) error {
+	var err error
+	switch strings.ToLower(strings.ReplaceAll(key, " ", "_")) {
+	case "mac":
+		var hwAddr net.HardwareAddr
+		if hwAddr, err = net.ParseMAC(value); err == nil {
+			cfg.MAC = hwAddr.String()
+		}
+	case "vlan":
+		cfg.Vlan, err = strconv.Atoi(value)
+	case "qos":
+		cfg.Qos, err = strconv.Atoi(value)
+	case "spoofcheck", "mac_anti_spoof":
+		cfg.SpoofChk, err = parseSysfsBool(value)
+	case "trust":
+		cfg.Trust, err = parseSysfsBool(value)
+	case "link_state", "linkstate":
+		cfg.LinkState, err = parseSysfsLinkState(value)
+	case "min_tx_rate", "mintxrate":
+		cfg.MinTxRate, err = strconv.Atoi(value)
+	case "max_tx_rate", "maxtxrate":
+		cfg.MaxTxRate, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s %q: %w", key, value, err)
+	}
+	return nil
+}
+
+// vfConfigSysfsKeys are the per attribute files exposed by drivers like ice
+// and i40e under sriov/<vf>
+var vfConfigSysfsKeys = []string{
+	"mac", "vlan", "qos", "spoofcheck", "mac_anti_spoof", "trust",
+	"link_state", "min_tx_rate", "max_tx_rate",
+}
+
+// GetVFConfigSysfs reads the administrative configuration of VF vfID on
+// pfName from the vendor sriov sysfs tree, which is faster than netlink for
+// bulk queries. mlx5 exposes a single "config" dump while Intel drivers use
+// one file per attribute; attributes the driver does not expose are left
+// unset, while attribute files that cannot be read or parsed are reported.
+// Devices without the sriov sysfs tree fall back to netlink.
+func GetVFConfigSysfs(pfName string, vfID int) (VFConfig, error) {
+	if err := ValidateInterfaceName(pfName); err != nil {
+		return VFConfig{}, err
+	}
+
+	vfDir := filepath.Join(NetDirectory, pfName, "device", "sriov", strconv.Itoa(vfID))
+	if _, err := os.Stat(vfDir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return SnapshotVFConfig(pfName, vfID)
+		}
+		return VFConfig{}, fmt.Errorf("failed to check %q: %w", vfDir, err)
+	}
+
+	var cfg VFConfig
+	data, err := os.ReadFile(filepath.Join(vfDir, "config"))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, found := strings.Cut(line, ":")
+			if !found {
+				continue
+			}
+			if err := setVFConfigField(&cfg, strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+				return VFConfig{}, fmt.Errorf("VF %d on %q: %w", vfID, pfName, err)
+			}
+		}
+		return cfg, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return VFConfig{}, fmt.Errorf("failed to read config of VF %d on %q: %w", vfID, pfName, err)
+	}
+
+	var errs []error
+	for _, key := range vfConfigSysfsKeys {
+		data, err := os.ReadFile(filepath.Join(vfDir, key))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("failed to read %s of VF %d on %q: %w", key, vfID, pfName, err))
+			}
+			continue
+		}
+		if err := setVFConfigField(&cfg, key, strings.TrimSpace(string(data))); err != nil {
+			errs = append(errs, fmt.Errorf("VF %d on %q: %w", vfID, pfName, err))
+		}
+	}
+	if err := joinErrors(errs); err != nil {
+		return VFConfig{}, err
+	}
+	return cfg, nil
+}
+
+// ComputeVFPci derives the PCI address of VF vfID of the PF at pfPci from the
+// SR-IOV offset and stride, the same way the kernel enumerates VFs, without
+// resolving the virtfn link of every VF
+func ComputeVFPci(pfPci string, vfID int) (string, error) {
+	domain, bus, device, function, err := ParsePCIAddress(pfPci)
+	if err != nil {
+		return "", err
+	}
+
+	totalVfs, err := readPciSriovAttr(pfPci, "sriov_totalvfs")
+	if err != nil {
+		return "", err
+	}
+	if vfID < 0 || vfID >= totalVfs {
+		return "", fmt.Errorf("invalid VF %d: PF %q supports %d VFs", vfID, pfPci, totalVfs)
+	}
+
+	offset, stride, err := GetSriovOffsetStride(pfPci)
+	if err != nil {
+		return "", err
+	}
+
+	// routing ID is bus(8) | device(5) | function(3)
+	rid := bus<<8 | device<<3 | function
+	vfRid := rid + offset + vfID*stride
+	if vfRid>>8 > 0xff {
+		return "", fmt.Errorf("VF %d of PF %q is beyond the last PCI bus", vfID, pfPci)
+	}
+	return fmt.Sprintf("%04x:%02x:%02x.%d", domain, vfRid>>8, (vfRid>>3)&0x1f, vfRid&0x7), nil
+}
+
+// ErrVFInUse is returned when removing the VFs of a PF while some of them
+// are in use
+var ErrVFInUse = errors.New("VF in use")
+
+// RemoveAllVFs disables SR-IOV on the PF pfName by writing 0 to its
+// sriov_numvfs. Unless force is set it refuses with ErrVFInUse when a VF
+// has its netdev moved out of the host namespace or is bound to a userspace
+// driver, as removing it would pull the device from under a running pod.
+func RemoveAllVFs(pfName string, force bool) error {
+	if err := ValidateInterfaceName(pfName); err != nil {
+		return err
+	}
+
+	if !force {
+		vfs, err := ListVFs(pfName)
+		if err != nil {
+			return err
+		}
+		inUse := []string{}
+		for _, vf := range vfs {
+			if isVFInUse(vf) {
+				inUse = append(inUse, vf.PCIAddress)
+			}
+		}
+		if len(inUse) > 0 {
+			return fmt.Errorf("failed to remove VFs of %q, %s: %w", pfName, strings.Join(inUse, ", "), ErrVFInUse)
+		}
+	}
+
+	return writeSysfsFile(filepath.Join(NetDirectory, pfName, "device", "sriov_numvfs"), "0")
+}
+
+// WaitForNumVfs waits up to timeout for sriov_numvfs of the PF ifName to
+// read back target, so VF creation or removal has completed
+func WaitForNumVfs(ifName string, target int, timeout time.Duration) error {
+	current := -1
+	err := pollUntil(timeout, func() (bool, error) {
+		var err error
+		current, err = GetSriovNumVfs(ifName)
+		return current == target, err
+	})
+	if errors.Is(err, errPollTimeout) {
+		return fmt.Errorf("PF %q has %d VFs after %v, expected %d", ifName, current, timeout, target)
+	}
+	return err
+}
+
+// WaitForVFPciDevices waits up to timeout for the PCI devices of the first
+// expected VFs of pfName to show up after VF creation and returns their
+// addresses ordered by VF ID. On timeout the addresses resolved so far are
+// returned along with the error.
+func WaitForVFPciDevices(pfName string, expected int, timeout time.Duration) ([]string, error) {
+	if expected < 0 {
+		return nil, fmt.Errorf("invalid number of VFs %d", expected)
+	}
+
+	vfPcis := make([]string, 0, expected)
+	err := pollUntil(timeout, func() (bool, error) {
+		vfPcis = vfPcis[:0]
+		for vfID := 0; vfID < expected; vfID++ {
+			vfPci, err := GetPciAddress(pfName, vfID)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return false, err
+			}
+			if _, err := os.Stat(filepath.Join(SysBusPci, vfPci)); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return false, fmt.Errorf("failed to check PCI device %q: %w", vfPci, err)
+			}
+			vfPcis = append(vfPcis, vfPci)
+		}
+		return len(vfPcis) == expected, nil
+	})
+	if errors.Is(err, errPollTimeout) {
+		return vfPcis, fmt.Errorf("PF %q has %d of %d VF PCI devices after %v", pfName, len(vfPcis), expected, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vfPcis, nil
+}
+
+// stableNetdevReads bounds the number of reads GetStableVFNetdev does before
+// giving up on a netdev that keeps being renamed
+const stableNetdevReads = 10
+
+// getVFNetdev returns the host netdev of VF vfID of pfName, or an empty name
+// when it has none
+func getVFNetdev(pfName string, vfID int) (string, error) {
+	vfPci, err := GetPciAddress(pfName, vfID)
+	if err != nil {
+		return "", err
+	}
+	netDevs, err := GetHostNetDevFromPci(vfPci)
+	if err != nil {
+		return "", err
+	}
+	if len(netDevs) == 0 {
+		return "", nil
+	}
+	return netDevs[0], nil
+}
+
+// GetStableVFNetdev returns the host netdev of VF vfID of pfName once two
+// reads settle apart agree, so a name udev is about to replace is not acted
+// on. This costs at least settle per call, and settle more for every rename
+// seen in between.
+func GetStableVFNetdev(pfName string, vfID int, settle time.Duration) (string, error) {
+	name, err := getVFNetdev(pfName, vfID)
+	if err != nil {
+		return "", err
+	}
+
+	for i := 1; i < stableNetdevReads; i++ {
+		time.Sleep(settle)
+		current, err := getVFNetdev(pfName, vfID)
+		if err != nil {
+			return "", err
+		}
+		if current == name {
+			if name == "" {
+				return "", fmt.Errorf("VF %d of %q has no net device", vfID, pfName)
+			}
+			return name, nil
+		}
+		name = current
+	}
+	return "", fmt.Errorf("net device of VF %d of %q still changing after %d reads", vfID, pfName, stableNetdevReads)
+}
+
+// unboundDriver is the GroupVFsByDriver bucket of VFs without a driver
+const unboundDriver = "<unbound>"
+
+// GroupVFsByDriver returns the PCI addresses of the VFs of pfName, in VF ID
+// order, grouped by the driver they are bound to, VFs without a driver being
+// listed under "<unbound>"
+func GroupVFsByDriver(pfName string) (map[string][]string, error) {
+	vfs, err := ListVFs(pfName)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]string{}
+	for _, vf := range vfs {
+		driver := vf.Driver
+		if driver == "" {
+			driver = unboundDriver
+		}
+		groups[driver] = append(groups[driver], vf.PCIAddress)
+	}
+	return groups, nil
+}
+
+// GetAllVFMacsSysfs returns the administrative MAC of every VF of pfName,
+// keyed by VF ID, in a single walk of the vendor sriov sysfs tree. Devices
+// without that tree are served by one netlink query instead. VFs without a
+// valid MAC assigned are left out.
+func GetAllVFMacsSysfs(pfName string) (map[int]string, error) {
+	if err := ValidateInterfaceName(pfName); err != nil {
+		return nil, err
+	}
+
+	macs := map[int]string{}
+	addMac := func(vfID int, mac string) {
+		if hwAddr, err := net.ParseMAC(mac); err == nil && IsValidMACAddress(hwAddr) {
+			macs[vfID] = hwAddr.String()
+		}
+	}
+
+	sriovDir := filepath.Join(NetDirectory, pfName, "device", "sriov")
+	entries, err := os.ReadDir(sriovDir)
+	if errors.Is(err, os.ErrNotExist) {
+		pfLink, err := netlinkOps.LinkByName(pfName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup PF %q: %w", pfName, err)
+		}
+		for _, vf := range pfLink.Attrs().Vfs {
+			addMac(vf.ID, vf.Mac.String())
+		}
+		return macs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", sriovDir, err)
+	}
+
+	for _, entry := range entries {
+		vfID, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		cfg, err := GetVFConfigSysfs(pfName, vfID)
+		if err != nil {
+			return nil, err
+		}
+		addMac(vfID, cfg.MAC)
+	}
+	return macs, nil
+}
@@ -0,0 +1,1229 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// newSriovSysfs returns a fake tree with PF enp59s0f0 at 0000:3b:00.0 and
+// its VFs 0000:3b:02.0 to 0000:3b:02.2, VF 1 having the netdev enp59s0f0v1,
+// and PF enp59s0f1 at 0000:3b:00.1 with VF 0000:3b:0a.0
+func newSriovSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2")
+	f.addNetdev("enp59s0f0v1", "0000:3b:02.1")
+	f.addPF("enp59s0f1", "0000:3b:00.1", "0000:3b:0a.0")
+	return f
+}
+
+func TestGetPfName(t *testing.T) {
+	newSriovSysfs(t)
+
+	tests := map[string]struct {
+		pciAddr string
+		want    string
+		wantErr error
+	}{
+		"VF of first PF":  {pciAddr: "0000:3b:02.2", want: "enp59s0f0"},
+		"VF of second PF": {pciAddr: "0000:3b:0a.0", want: "enp59s0f1"},
+		"PF":              {pciAddr: "0000:3b:00.0", wantErr: ErrNotVF},
+		"missing device":  {pciAddr: "0000:3b:09.0"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetPfName(tt.pciAddr)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("GetPfName(%q) = %q, want error", tt.pciAddr, got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetPfName(%q) error = %v, want %v", tt.pciAddr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPfName(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetPfName(%q) = %q, want %q", tt.pciAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPfNameWithoutNetdev(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addVF("0000:3b:00.0", 0, "0000:3b:02.0")
+
+	if got, err := GetPfName("0000:3b:02.0"); err == nil {
+		t.Errorf("GetPfName() = %q, want error for a PF without netdev", got)
+	}
+}
+
+func TestGetPfNameOrPci(t *testing.T) {
+	f := newSriovSysfs(t)
+	// a PF bound to a userspace driver has no net directory at all, one
+	// whose netdev is gone keeps an empty one
+	f.addVF("0000:5e:00.0", 0, "0000:5e:02.0")
+	f.bindDriver("0000:5e:00.0", "vfio-pci")
+	f.addVF("0000:af:00.0", 0, "0000:af:02.0")
+	f.mkdir(filepath.Join(SysBusPci, "0000:af:00.0", "net"))
+
+	tests := map[string]struct {
+		pciAddr       string
+		want          string
+		wantHasNetdev bool
+		wantErr       error
+	}{
+		"PF with netdev":        {pciAddr: "0000:3b:02.2", want: "enp59s0f0", wantHasNetdev: true},
+		"other PF with netdev":  {pciAddr: "0000:3b:0a.0", want: "enp59s0f1", wantHasNetdev: true},
+		"DPDK PF":               {pciAddr: "0000:5e:02.0", want: "0000:5e:00.0"},
+		"PF with empty net dir": {pciAddr: "0000:af:02.0", want: "0000:af:00.0"},
+		"PF":                    {pciAddr: "0000:3b:00.0", wantErr: ErrNotVF},
+		"missing device":        {pciAddr: "0000:3b:09.0", wantErr: os.ErrNotExist},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, hasNetdev, err := GetPfNameOrPci(tt.pciAddr)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetPfNameOrPci(%q) error = %v, want %v", tt.pciAddr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPfNameOrPci(%q) failed: %v", tt.pciAddr, err)
+			}
+			if got != tt.want || hasNetdev != tt.wantHasNetdev {
+				t.Errorf("GetPfNameOrPci(%q) = %q, %v, want %q, %v", tt.pciAddr, got, hasNetdev, tt.want, tt.wantHasNetdev)
+			}
+			if hasNetdev {
+				if pfName, err := GetPfName(tt.pciAddr); err != nil || pfName != got {
+					t.Errorf("GetPfName(%q) = %q, %v, want the same PF %q", tt.pciAddr, pfName, err, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetVfid(t *testing.T) {
+	newSriovSysfs(t)
+
+	tests := map[string]struct {
+		pciAddr string
+		pfName  string
+		want    int
+		wantErr bool
+	}{
+		"first VF":   {pciAddr: "0000:3b:02.0", pfName: "enp59s0f0", want: 0},
+		"last VF":    {pciAddr: "0000:3b:02.2", pfName: "enp59s0f0", want: 2},
+		"other PF":   {pciAddr: "0000:3b:0a.0", pfName: "enp59s0f1", want: 0},
+		"unknown VF": {pciAddr: "0000:3b:02.7", pfName: "enp59s0f0", wantErr: true},
+		"unknown PF": {pciAddr: "0000:3b:02.0", pfName: "enp59s0f9", wantErr: true},
+		"not a VF":   {pciAddr: "0000:3b:00.1", pfName: "enp59s0f0", wantErr: true},
+		"invalid PF": {pciAddr: "0000:3b:02.0", pfName: "../enp59s0f0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetVfid(tt.pciAddr, tt.pfName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetVfid(%q, %q) = %d, want error", tt.pciAddr, tt.pfName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVfid(%q, %q) failed: %v", tt.pciAddr, tt.pfName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetVfid(%q, %q) = %d, want %d", tt.pciAddr, tt.pfName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVfidOtherPF(t *testing.T) {
+	newSriovSysfs(t)
+
+	_, err := GetVfid("0000:3b:0a.0", "enp59s0f0")
+	if !errors.Is(err, ErrVFNotOnPF) {
+		t.Errorf("GetVfid() error = %v, want %v", err, ErrVFNotOnPF)
+	}
+}
+
+func TestGetVfidSriovNotEnabled(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0")
+
+	_, err := GetVfid("0000:3b:02.0", "enp59s0f0")
+	if !errors.Is(err, ErrSriovNotEnabled) {
+		t.Errorf("GetVfid() error = %v, want %v", err, ErrSriovNotEnabled)
+	}
+}
+
+func TestGetVFIDFromNetdev(t *testing.T) {
+	newSriovSysfs(t)
+
+	tests := map[string]struct {
+		ifName     string
+		wantVFID   int
+		wantPfName string
+		wantErr    error
+	}{
+		"VF netdev":      {ifName: "enp59s0f0v1", wantVFID: 1, wantPfName: "enp59s0f0"},
+		"PF netdev":      {ifName: "enp59s0f0", wantErr: ErrNotVF},
+		"missing netdev": {ifName: "enp59s0f0v9"},
+		"invalid name":   {ifName: "enp59s0f0/v1"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			vfID, pfName, err := GetVFIDFromNetdev(tt.ifName)
+			if tt.wantPfName == "" {
+				if err == nil {
+					t.Fatalf("GetVFIDFromNetdev(%q) = %d, %q, want error", tt.ifName, vfID, pfName)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetVFIDFromNetdev(%q) error = %v, want %v", tt.ifName, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVFIDFromNetdev(%q) failed: %v", tt.ifName, err)
+			}
+			if vfID != tt.wantVFID || pfName != tt.wantPfName {
+				t.Errorf("GetVFIDFromNetdev(%q) = %d, %q, want %d, %q", tt.ifName, vfID, pfName, tt.wantVFID, tt.wantPfName)
+			}
+		})
+	}
+}
+
+func TestGetPFNetdevFromVFNetdev(t *testing.T) {
+	f := newSriovSysfs(t)
+	f.addNetdev("enp59s0f1v0", "0000:3b:0a.0")
+	f.addNetdev("br0", "")
+
+	tests := map[string]struct {
+		ifName  string
+		want    string
+		wantErr error
+	}{
+		"VF netdev of first PF":  {ifName: "enp59s0f0v1", want: "enp59s0f0"},
+		"VF netdev of second PF": {ifName: "enp59s0f1v0", want: "enp59s0f1"},
+		"PF netdev":              {ifName: "enp59s0f0", wantErr: ErrNotVF},
+		"virtual netdev":         {ifName: "br0"},
+		"missing netdev":         {ifName: "enp59s0f0v9"},
+		"invalid name":           {ifName: "enp59s0f0/v1"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetPFNetdevFromVFNetdev(tt.ifName)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("GetPFNetdevFromVFNetdev(%q) = %q, want error", tt.ifName, got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetPFNetdevFromVFNetdev(%q) error = %v, want %v", tt.ifName, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPFNetdevFromVFNetdev(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetPFNetdevFromVFNetdev(%q) = %q, want %q", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForVFPciDevices(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0")
+
+	// the remaining VFs show up one after the other while polling
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for vfID, vfPci := range []string{"0000:3b:02.1", "0000:3b:02.2"} {
+			time.Sleep(pollInterval)
+			if err := os.MkdirAll(filepath.Join(SysBusPci, vfPci), 0755); err != nil {
+				t.Errorf("failed to add VF %q: %v", vfPci, err)
+				return
+			}
+			virtfn := filepath.Join(SysBusPci, "0000:3b:00.0", fmt.Sprintf("virtfn%d", vfID+1))
+			if err := os.Symlink(filepath.Join(SysBusPci, vfPci), virtfn); err != nil {
+				t.Errorf("failed to link VF %q: %v", vfPci, err)
+				return
+			}
+		}
+	}()
+
+	got, err := WaitForVFPciDevices("enp59s0f0", 3, 10*time.Second)
+	<-done
+	if err != nil {
+		t.Fatalf("WaitForVFPciDevices() failed: %v", err)
+	}
+	want := []string{"0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WaitForVFPciDevices() = %v, want %v", got, want)
+	}
+}
+
+func TestWaitForVFPciDevicesTimeout(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2")
+	// VF 1 is linked from the PF but its PCI device is not populated yet
+	f.remove(filepath.Join(SysBusPci, "0000:3b:02.1"))
+
+	got, err := WaitForVFPciDevices("enp59s0f0", 4, 0)
+	if err == nil {
+		t.Fatal("WaitForVFPciDevices() succeeded, want timeout error")
+	}
+	want := []string{"0000:3b:02.0", "0000:3b:02.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WaitForVFPciDevices() = %v, want partial %v", got, want)
+	}
+}
+
+// setNumVfsLater replaces sriov_numvfs of the PF device pfPci with numVfs
+// after delay, the way the kernel updates it once the VFs are created. The
+// returned channel is closed once the value has been written.
+func setNumVfsLater(t *testing.T, pfPci string, numVfs int, delay time.Duration) <-chan struct{} {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(delay)
+		// rename so a concurrent read never sees a partially written value
+		attrFile := filepath.Join(SysBusPci, pfPci, "sriov_numvfs")
+		if err := os.WriteFile(attrFile+".new", []byte(fmt.Sprintf("%d\n", numVfs)), 0644); err != nil {
+			t.Errorf("failed to write sriov_numvfs: %v", err)
+			return
+		}
+		if err := os.Rename(attrFile+".new", attrFile); err != nil {
+			t.Errorf("failed to update sriov_numvfs: %v", err)
+		}
+	}()
+	return done
+}
+
+func TestWaitForNumVfs(t *testing.T) {
+	tests := map[string]struct {
+		initial, target int
+	}{
+		"VFs created": {initial: 0, target: 4},
+		"VFs removed": {initial: 4, target: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			f.addPF("enp59s0f0", "0000:3b:00.0")
+			f.addPciDevice("0000:3b:00.0", map[string]string{"sriov_numvfs": fmt.Sprintf("%d\n", tt.initial)})
+
+			done := setNumVfsLater(t, "0000:3b:00.0", tt.target, 2*pollInterval)
+			err := WaitForNumVfs("enp59s0f0", tt.target, 10*time.Second)
+			<-done
+			if err != nil {
+				t.Fatalf("WaitForNumVfs(%d) failed: %v", tt.target, err)
+			}
+		})
+	}
+}
+
+func TestWaitForNumVfsAlreadyReached(t *testing.T) {
+	newSriovSysfs(t)
+
+	if err := WaitForNumVfs("enp59s0f0", 3, 0); err != nil {
+		t.Errorf("WaitForNumVfs() failed: %v", err)
+	}
+}
+
+func TestWaitForNumVfsErrors(t *testing.T) {
+	f := newSriovSysfs(t)
+	f.addNetdev("eno1", "0000:01:00.0")
+
+	tests := map[string]struct {
+		ifName string
+		target int
+	}{
+		"timeout":      {ifName: "enp59s0f0", target: 4},
+		"missing PF":   {ifName: "enp59s0f9", target: 4},
+		"not SR-IOV":   {ifName: "eno1", target: 4},
+		"invalid name": {ifName: "../enp59s0f0", target: 4},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := WaitForNumVfs(tt.ifName, tt.target, pollInterval); err == nil {
+				t.Errorf("WaitForNumVfs(%q, %d) succeeded, want error", tt.ifName, tt.target)
+			}
+		})
+	}
+}
+
+func TestGetStableVFNetdev(t *testing.T) {
+	newSriovSysfs(t)
+	netDir := filepath.Join(SysBusPci, "0000:3b:02.1", "net")
+
+	// udev renames the netdev once between the first two reads
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(50 * time.Millisecond)
+		if err := os.Rename(filepath.Join(netDir, "enp59s0f0v1"), filepath.Join(netDir, "eth-vf1")); err != nil {
+			t.Errorf("failed to rename netdev: %v", err)
+		}
+	}()
+
+	got, err := GetStableVFNetdev("enp59s0f0", 1, 100*time.Millisecond)
+	<-done
+	if err != nil {
+		t.Fatalf("GetStableVFNetdev() failed: %v", err)
+	}
+	if got != "eth-vf1" {
+		t.Errorf("GetStableVFNetdev() = %q, want %q", got, "eth-vf1")
+	}
+}
+
+func TestGetStableVFNetdevErrors(t *testing.T) {
+	newSriovSysfs(t)
+
+	tests := map[string]struct {
+		pfName string
+		vfID   int
+	}{
+		"VF without netdev": {pfName: "enp59s0f0", vfID: 0},
+		"missing VF":        {pfName: "enp59s0f0", vfID: 7},
+		"missing PF":        {pfName: "enp59s0f9", vfID: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := GetStableVFNetdev(tt.pfName, tt.vfID, 0); err == nil {
+				t.Errorf("GetStableVFNetdev(%q, %d) = %q, want error", tt.pfName, tt.vfID, got)
+			}
+		})
+	}
+}
+
+func TestEnsureNumVfs(t *testing.T) {
+	newSriovSysfs(t)
+
+	tests := map[string]struct {
+		ifName   string
+		expected int
+		wantErr  bool
+	}{
+		"match":      {ifName: "enp59s0f0", expected: 3},
+		"fewer VFs":  {ifName: "enp59s0f0", expected: 4, wantErr: true},
+		"more VFs":   {ifName: "enp59s0f1", expected: 0, wantErr: true},
+		"missing PF": {ifName: "enp59s0f9", expected: 0, wantErr: true},
+		"invalid PF": {ifName: "../enp59s0f0", expected: 3, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := EnsureNumVfs(tt.ifName, tt.expected)
+			if tt.wantErr && err == nil {
+				t.Errorf("EnsureNumVfs(%q, %d) succeeded, want error", tt.ifName, tt.expected)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("EnsureNumVfs(%q, %d) failed: %v", tt.ifName, tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestIsPFWithVFs(t *testing.T) {
+	f := newSriovSysfs(t)
+	f.addPF("enp94s0f0", "0000:5e:00.0")
+	f.addPciDevice("0000:01:00.0", nil)
+
+	tests := map[string]struct {
+		pciAddr    string
+		wantPF     bool
+		wantNumVfs int
+		wantErr    bool
+	}{
+		"PF with VFs":        {pciAddr: "0000:3b:00.0", wantPF: true, wantNumVfs: 3},
+		"PF without VFs":     {pciAddr: "0000:5e:00.0", wantPF: true},
+		"VF":                 {pciAddr: "0000:3b:02.0"},
+		"not SR-IOV capable": {pciAddr: "0000:01:00.0"},
+		"missing PCI device": {pciAddr: "0000:3b:09.0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			isPF, numVfs, err := IsPFWithVFs(tt.pciAddr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("IsPFWithVFs(%q) = %v, %d, want error", tt.pciAddr, isPF, numVfs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IsPFWithVFs(%q) failed: %v", tt.pciAddr, err)
+			}
+			if isPF != tt.wantPF || numVfs != tt.wantNumVfs {
+				t.Errorf("IsPFWithVFs(%q) = %v, %d, want %v, %d", tt.pciAddr, isPF, numVfs, tt.wantPF, tt.wantNumVfs)
+			}
+		})
+	}
+}
+
+// newIBSysfs returns a fake tree with the InfiniBand PF ib0 whose VF 0 has
+// node and port GUIDs, and the Ethernet PF enp59s0f0
+func newIBSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	f.addPF("ib0", "0000:af:00.0", "0000:af:00.1")
+	f.writeFile(filepath.Join(NetDirectory, "ib0", "type"), "32\n")
+	sriovDir := filepath.Join(SysBusPci, "0000:af:00.0", "sriov", "0")
+	f.writeFile(filepath.Join(sriovDir, "node"), "00:11:22:33:44:55:66:77\n")
+	f.writeFile(filepath.Join(sriovDir, "port"), "00:11:22:33:44:55:66:78\n")
+
+	f.addPF("enp59s0f0", "0000:3b:00.0", "0000:3b:02.0")
+	f.writeFile(filepath.Join(NetDirectory, "enp59s0f0", "type"), "1\n")
+	return f
+}
+
+func TestGetVFGUID(t *testing.T) {
+	newIBSysfs(t)
+
+	tests := map[string]struct {
+		pfName   string
+		vfID     int
+		wantNode string
+		wantPort string
+		wantErr  error
+	}{
+		"InfiniBand VF": {pfName: "ib0", wantNode: "00:11:22:33:44:55:66:77", wantPort: "00:11:22:33:44:55:66:78"},
+		"missing VF":    {pfName: "ib0", vfID: 3, wantErr: os.ErrNotExist},
+		"Ethernet PF":   {pfName: "enp59s0f0", wantErr: ErrNotInfiniband},
+		"missing PF":    {pfName: "ib9", wantErr: os.ErrNotExist},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			node, port, err := GetVFGUID(tt.pfName, tt.vfID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetVFGUID(%q, %d) error = %v, want %v", tt.pfName, tt.vfID, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVFGUID(%q, %d) failed: %v", tt.pfName, tt.vfID, err)
+			}
+			if node != tt.wantNode || port != tt.wantPort {
+				t.Errorf("GetVFGUID(%q, %d) = %q, %q, want %q, %q", tt.pfName, tt.vfID, node, port, tt.wantNode, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestSetVFGUID(t *testing.T) {
+	tests := map[string]struct {
+		pfName   string
+		guid     string
+		readOnly bool
+		want     string
+		wantErr  bool
+		wantIs   error
+	}{
+		"canonical GUID":    {pfName: "ib0", guid: "00:11:22:33:44:55:66:aa", want: "00:11:22:33:44:55:66:aa"},
+		"upper case GUID":   {pfName: "ib0", guid: "00:11:22:33:44:55:66:AA", want: "00:11:22:33:44:55:66:aa"},
+		"MAC is not a GUID": {pfName: "ib0", guid: "02:aa:bb:cc:dd:01", wantErr: true},
+		"malformed GUID":    {pfName: "ib0", guid: "not-a-guid", wantErr: true},
+		"Ethernet PF":       {pfName: "enp59s0f0", guid: "00:11:22:33:44:55:66:aa", wantErr: true, wantIs: ErrNotInfiniband},
+		"read-only sysfs":   {pfName: "ib0", guid: "00:11:22:33:44:55:66:aa", readOnly: true, wantErr: true, wantIs: ErrSysfsReadOnly},
+		"invalid PF name":   {pfName: "../ib0", guid: "00:11:22:33:44:55:66:aa", wantErr: true},
+	}
+
+	setters := map[string]func(string, int, string) error{
+		"node": SetVFNodeGUID,
+		"port": SetVFPortGUID,
+	}
+
+	for name, tt := range tests {
+		for kind, set := range setters {
+			t.Run(name+"/"+kind, func(t *testing.T) {
+				newIBSysfs(t)
+				if tt.readOnly {
+					failSysfsWrites(t, func(string) bool { return true }, syscall.EROFS)
+				}
+				guidFile := filepath.Join(SysBusPci, "0000:af:00.0", "sriov", "0", kind)
+				before, err := os.ReadFile(guidFile)
+				if err != nil {
+					t.Fatalf("failed to read %q: %v", guidFile, err)
+				}
+
+				err = set(tt.pfName, 0, tt.guid)
+				if tt.wantErr {
+					if err == nil || (tt.wantIs != nil && !errors.Is(err, tt.wantIs)) {
+						t.Fatalf("setting %s GUID %q on %q: error = %v, want %v", kind, tt.guid, tt.pfName, err, tt.wantIs)
+					}
+					if after, _ := os.ReadFile(guidFile); string(after) != string(before) {
+						t.Errorf("%s GUID changed to %q despite the error", kind, after)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("setting %s GUID %q on %q failed: %v", kind, tt.guid, tt.pfName, err)
+				}
+				if got, _ := os.ReadFile(guidFile); string(got) != tt.want {
+					t.Errorf("%s GUID = %q, want %q", kind, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestGetVFConfigSysfs(t *testing.T) {
+	want := VFConfig{
+		MAC:       "02:aa:bb:cc:dd:01",
+		Vlan:      100,
+		Qos:       3,
+		MaxTxRate: 1000,
+		SpoofChk:  true,
+		LinkState: netlink.VF_LINK_STATE_AUTO,
+	}
+
+	tests := map[string]struct {
+		files map[string]string
+		// dirs are created in place of attribute files, which makes them
+		// unreadable
+		dirs       []string
+		want       VFConfig
+		wantErr    bool
+		wantErrKey string
+	}{
+		"mlx5 config dump": {
+			files: map[string]string{"config": "VF         : 0\n" +
+				"MAC        : 02:AA:BB:CC:DD:01\n" +
+				"VLAN       : 100\n" +
+				"QoS        : 3\n" +
+				"VLAN Proto : 802.1q\n" +
+				"SpoofCheck : ON\n" +
+				"Trust      : OFF\n" +
+				"LinkState  : Follow\n" +
+				"MinTxRate  : 0\n" +
+				"MaxTxRate  : 1000\n"},
+			want: want,
+		},
+		"per attribute files": {
+			files: map[string]string{
+				"mac":         "02:aa:bb:cc:dd:01\n",
+				"vlan":        "100\n",
+				"qos":         "3\n",
+				"spoofcheck":  "on\n",
+				"trust":       "off\n",
+				"link_state":  "auto\n",
+				"max_tx_rate": "1000\n",
+			},
+			want: want,
+		},
+		"missing attribute files are left unset": {
+			files: map[string]string{"vlan": "100\n"},
+			want:  VFConfig{Vlan: 100},
+		},
+		"malformed config dump": {
+			files:   map[string]string{"config": "VLAN : abc\n"},
+			wantErr: true,
+		},
+		"malformed attribute file": {
+			files:      map[string]string{"vlan": "100\n", "trust": "maybe\n"},
+			wantErr:    true,
+			wantErrKey: "trust",
+		},
+		"malformed attribute files": {
+			files:      map[string]string{"spoofcheck": "yes please\n", "max_tx_rate": "fast\n"},
+			wantErr:    true,
+			wantErrKey: "spoofcheck",
+		},
+		"unreadable attribute file": {
+			files:      map[string]string{"vlan": "100\n"},
+			dirs:       []string{"spoofcheck"},
+			wantErr:    true,
+			wantErrKey: "spoofcheck",
+		},
+		"unreadable config dump": {
+			dirs:    []string{"config"},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newSriovSysfs(t)
+			vfDir := filepath.Join(SysBusPci, "0000:3b:00.0", "sriov", "0")
+			f.mkdir(vfDir)
+			for file, content := range tt.files {
+				f.writeFile(filepath.Join(vfDir, file), content)
+			}
+			for _, dir := range tt.dirs {
+				f.mkdir(filepath.Join(vfDir, dir))
+			}
+			// the sysfs path must not need netlink
+			nl := newFakeNetlink(t)
+			nl.errs["LinkByName"] = syscall.EPERM
+
+			got, err := GetVFConfigSysfs("enp59s0f0", 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetVFConfigSysfs() = %+v, want error", got)
+				}
+				if !strings.Contains(err.Error(), tt.wantErrKey) {
+					t.Errorf("GetVFConfigSysfs() error = %v, want it to name %s", err, tt.wantErrKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVFConfigSysfs() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetVFConfigSysfs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVFConfigSysfsNetlinkFallback(t *testing.T) {
+	newSriovSysfs(t)
+	pf := newFakePF("enp59s0f0", 3)
+	pf.Vfs[1] = netlink.VfInfo{
+		ID:        1,
+		Mac:       net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01},
+		Vlan:      100,
+		MaxTxRate: 1000,
+		Trust:     1,
+		LinkState: netlink.VF_LINK_STATE_ENABLE,
+	}
+	newFakeNetlink(t, pf)
+
+	got, err := GetVFConfigSysfs("enp59s0f0", 1)
+	if err != nil {
+		t.Fatalf("GetVFConfigSysfs() failed: %v", err)
+	}
+	want, err := SnapshotVFConfig("enp59s0f0", 1)
+	if err != nil {
+		t.Fatalf("SnapshotVFConfig() failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("GetVFConfigSysfs() = %+v, want the netlink config %+v", got, want)
+	}
+	if got.MAC != "02:aa:bb:cc:dd:01" || got.Vlan != 100 || !got.Trust {
+		t.Errorf("GetVFConfigSysfs() = %+v, want the VF settings", got)
+	}
+
+	if _, err := GetVFConfigSysfs("enp59s0f0", 5); err == nil {
+		t.Error("GetVFConfigSysfs() succeeded for a missing VF, want error")
+	}
+}
+
+func TestSupportsSriov(t *testing.T) {
+	f := newSriovSysfs(t)
+	f.addPF("enp94s0f0", "0000:5e:00.0")
+	f.addNetdev("enp1s0", "0000:01:00.0")
+	f.addNetdev("eno1", "0000:02:00.0")
+	f.writeFile(filepath.Join(SysBusPci, "0000:02:00.0", "sriov_totalvfs"), "0\n")
+	f.addNetdev("enp3s0", "0000:03:00.0")
+	f.writeFile(filepath.Join(SysBusPci, "0000:03:00.0", "sriov_totalvfs"), "many\n")
+	f.addNetdev("dummy0", "")
+
+	tests := map[string]struct {
+		ifName  string
+		want    bool
+		wantErr bool
+	}{
+		"PF with VFs":            {ifName: "enp59s0f0", want: true},
+		"PF without VFs enabled": {ifName: "enp94s0f0", want: true},
+		"NIC without SR-IOV":     {ifName: "enp1s0"},
+		"zero total VFs":         {ifName: "eno1"},
+		"VF":                     {ifName: "enp59s0f0v1"},
+		"virtual interface":      {ifName: "dummy0"},
+		"malformed total VFs":    {ifName: "enp3s0", wantErr: true},
+		"missing interface":      {ifName: "enp59s0f9", wantErr: true},
+		"invalid interface name": {ifName: "../enp59s0f0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := SupportsSriov(tt.ifName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SupportsSriov(%q) = %v, want error", tt.ifName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SupportsSriov(%q) failed: %v", tt.ifName, err)
+			}
+			if got != tt.want {
+				t.Errorf("SupportsSriov(%q) = %v, want %v", tt.ifName, got, tt.want)
+			}
+		})
+	}
+}
+
+// offsetStridePF describes a PF of newOffsetStrideSysfs, its VFs being
+// enumerated at the addresses the kernel derives from offset and stride
+type offsetStridePF struct {
+	name, pci      string
+	offset, stride int
+	vfPcis         []string
+}
+
+var offsetStridePFs = []offsetStridePF{
+	{name: "enp59s0f0", pci: "0000:3b:00.0", offset: 16, stride: 1, vfPcis: []string{
+		"0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2", "0000:3b:02.3",
+		"0000:3b:02.4", "0000:3b:02.5", "0000:3b:02.6", "0000:3b:02.7",
+		"0000:3b:03.0", "0000:3b:03.1",
+	}},
+	{name: "enp59s0f1", pci: "0000:3b:00.1", offset: 79, stride: 1, vfPcis: []string{
+		"0000:3b:0a.0", "0000:3b:0a.1",
+	}},
+	{name: "enp94s0", pci: "0000:5e:00.0", offset: 4, stride: 2, vfPcis: []string{
+		"0000:5e:00.4", "0000:5e:00.6", "0000:5e:01.0", "0000:5e:01.2",
+	}},
+	{name: "enp216s0", pci: "0000:d8:00.0", offset: 256, stride: 1, vfPcis: []string{
+		"0000:d9:00.0", "0000:d9:00.1",
+	}},
+	{name: "enP1p59s0", pci: "0001:3b:00.0", offset: 16, stride: 1, vfPcis: []string{
+		"0001:3b:02.0",
+	}},
+}
+
+// newOffsetStrideSysfs returns a fake tree holding offsetStridePFs with
+// their sriov_offset and sriov_stride
+func newOffsetStrideSysfs(t *testing.T) *fakeSysfs {
+	t.Helper()
+
+	f := newFakeSysfs(t)
+	for _, pf := range offsetStridePFs {
+		f.addPF(pf.name, pf.pci, pf.vfPcis...)
+		f.addPciDevice(pf.pci, map[string]string{
+			"sriov_offset": fmt.Sprintf("%d\n", pf.offset),
+			"sriov_stride": fmt.Sprintf("%d\n", pf.stride),
+		})
+	}
+	return f
+}
+
+func TestGetSriovOffsetStride(t *testing.T) {
+	f := newOffsetStrideSysfs(t)
+	f.addPciDevice("0000:af:00.0", map[string]string{"sriov_offset": "2\n"})
+	f.addPciDevice("0000:af:00.1", map[string]string{"sriov_offset": "2\n", "sriov_stride": "one\n"})
+
+	tests := map[string]struct {
+		pfPci      string
+		wantOffset int
+		wantStride int
+		wantErr    bool
+	}{
+		"stride 1":         {pfPci: "0000:3b:00.0", wantOffset: 16, wantStride: 1},
+		"second function":  {pfPci: "0000:3b:00.1", wantOffset: 79, wantStride: 1},
+		"stride 2":         {pfPci: "0000:5e:00.0", wantOffset: 4, wantStride: 2},
+		"missing stride":   {pfPci: "0000:af:00.0", wantErr: true},
+		"malformed stride": {pfPci: "0000:af:00.1", wantErr: true},
+		"not a PF":         {pfPci: "0000:3b:02.0", wantErr: true},
+		"missing device":   {pfPci: "0000:3b:09.0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			offset, stride, err := GetSriovOffsetStride(tt.pfPci)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetSriovOffsetStride(%q) = %d, %d, want error", tt.pfPci, offset, stride)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSriovOffsetStride(%q) failed: %v", tt.pfPci, err)
+			}
+			if offset != tt.wantOffset || stride != tt.wantStride {
+				t.Errorf("GetSriovOffsetStride(%q) = %d, %d, want %d, %d",
+					tt.pfPci, offset, stride, tt.wantOffset, tt.wantStride)
+			}
+		})
+	}
+}
+
+func TestGetSriovOffsetStrideMatchesVirtfn(t *testing.T) {
+	newOffsetStrideSysfs(t)
+
+	for _, pf := range offsetStridePFs {
+		offset, stride, err := GetSriovOffsetStride(pf.pci)
+		if err != nil {
+			t.Fatalf("GetSriovOffsetStride(%q) failed: %v", pf.pci, err)
+		}
+		domain, bus, device, function, err := ParsePCIAddress(pf.pci)
+		if err != nil {
+			t.Fatalf("ParsePCIAddress(%q) failed: %v", pf.pci, err)
+		}
+		for vfID := range pf.vfPcis {
+			rid := (bus<<8 | device<<3 | function) + offset + vfID*stride
+			computed := fmt.Sprintf("%04x:%02x:%02x.%d", domain, rid>>8, (rid>>3)&0x1f, rid&0x7)
+			linked, err := GetPciAddress(pf.name, vfID)
+			if err != nil {
+				t.Fatalf("GetPciAddress(%q, %d) failed: %v", pf.name, vfID, err)
+			}
+			if computed != linked {
+				t.Errorf("VF %d of %q computed at %q, virtfn link points to %q", vfID, pf.name, computed, linked)
+			}
+		}
+	}
+}
+
+func TestComputeVFPci(t *testing.T) {
+	newOffsetStrideSysfs(t)
+
+	for _, pf := range offsetStridePFs {
+		t.Run(pf.name, func(t *testing.T) {
+			for vfID := range pf.vfPcis {
+				computed, err := ComputeVFPci(pf.pci, vfID)
+				if err != nil {
+					t.Fatalf("ComputeVFPci(%q, %d) failed: %v", pf.pci, vfID, err)
+				}
+				linked, err := GetPciAddress(pf.name, vfID)
+				if err != nil {
+					t.Fatalf("GetPciAddress(%q, %d) failed: %v", pf.name, vfID, err)
+				}
+				if computed != linked {
+					t.Errorf("ComputeVFPci(%q, %d) = %q, GetPciAddress() = %q", pf.pci, vfID, computed, linked)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeVFPciErrors(t *testing.T) {
+	f := newOffsetStrideSysfs(t)
+	f.addPciDevice("0000:ff:00.0", map[string]string{
+		"sriov_totalvfs": "64\n",
+		"sriov_offset":   "256\n",
+		"sriov_stride":   "1\n",
+	})
+	f.addPciDevice("0000:af:00.0", map[string]string{"sriov_totalvfs": "8\n"})
+
+	tests := map[string]struct {
+		pfPci string
+		vfID  int
+	}{
+		"negative VF":         {pfPci: "0000:3b:00.0", vfID: -1},
+		"VF beyond totalvfs":  {pfPci: "0000:3b:00.0", vfID: 64},
+		"beyond the last bus": {pfPci: "0000:ff:00.0", vfID: 0},
+		"no offset":           {pfPci: "0000:af:00.0", vfID: 0},
+		"not a PF":            {pfPci: "0000:3b:02.0", vfID: 0},
+		"invalid PF address":  {pfPci: "3b:00.0", vfID: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := ComputeVFPci(tt.pfPci, tt.vfID); err == nil {
+				t.Errorf("ComputeVFPci(%q, %d) = %q, want error", tt.pfPci, tt.vfID, got)
+			}
+		})
+	}
+}
+
+func BenchmarkComputeVFPci(b *testing.B) {
+	f := newFakeSysfs(b)
+	f.addPciDevice("0000:3b:00.0", map[string]string{
+		"sriov_totalvfs": "64\n",
+		"sriov_offset":   "16\n",
+		"sriov_stride":   "1\n",
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ComputeVFPci("0000:3b:00.0", i%64); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGroupVFsByDriver(t *testing.T) {
+	tests := map[string]struct {
+		drivers map[string]string
+		want    map[string][]string
+	}{
+		"mixed drivers": {
+			drivers: map[string]string{
+				"0000:3b:02.0": "iavf",
+				"0000:3b:02.1": "vfio-pci",
+				"0000:3b:02.2": "iavf",
+				"0000:3b:02.4": "vfio-pci",
+			},
+			want: map[string][]string{
+				"iavf":        {"0000:3b:02.0", "0000:3b:02.2"},
+				"vfio-pci":    {"0000:3b:02.1", "0000:3b:02.4"},
+				unboundDriver: {"0000:3b:02.3"},
+			},
+		},
+		"single driver": {
+			drivers: map[string]string{
+				"0000:3b:02.0": "mlx5_core",
+				"0000:3b:02.1": "mlx5_core",
+				"0000:3b:02.2": "mlx5_core",
+				"0000:3b:02.3": "mlx5_core",
+				"0000:3b:02.4": "mlx5_core",
+			},
+			want: map[string][]string{
+				"mlx5_core": {"0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2", "0000:3b:02.3", "0000:3b:02.4"},
+			},
+		},
+		"all unbound": {
+			want: map[string][]string{
+				unboundDriver: {"0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2", "0000:3b:02.3", "0000:3b:02.4"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			f.addPF("enp59s0f0", "0000:3b:00.0",
+				"0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2", "0000:3b:02.3", "0000:3b:02.4")
+			for vfPci, driver := range tt.drivers {
+				f.bindDriver(vfPci, driver)
+			}
+
+			got, err := GroupVFsByDriver("enp59s0f0")
+			if err != nil {
+				t.Fatalf("GroupVFsByDriver() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GroupVFsByDriver() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupVFsByDriverErrors(t *testing.T) {
+	f := newSriovSysfs(t)
+	// VF 2 is linked from the PF but its PCI device is gone
+	f.remove(filepath.Join(SysBusPci, "0000:3b:02.2"))
+
+	for _, pfName := range []string{"enp59s0f0", "enp59s0f9", "../enp59s0f0"} {
+		if got, err := GroupVFsByDriver(pfName); err == nil {
+			t.Errorf("GroupVFsByDriver(%q) = %v, want error", pfName, got)
+		}
+	}
+}
+
+func TestGroupVFsByDriverVFsBeingCreated(t *testing.T) {
+	f := newSriovSysfs(t)
+	f.bindDriver("0000:3b:02.1", "iavf")
+	// VF 3 is linked while sriov_numvfs still reads 3
+	f.addVF("0000:3b:00.0", 3, "0000:3b:02.3")
+
+	got, err := GroupVFsByDriver("enp59s0f0")
+	if err != nil {
+		t.Fatalf("GroupVFsByDriver() failed: %v", err)
+	}
+	want := map[string][]string{
+		"iavf":        {"0000:3b:02.1"},
+		unboundDriver: {"0000:3b:02.0", "0000:3b:02.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupVFsByDriver() = %v, want the VFs listed by ListVFs %v", got, want)
+	}
+}
+
+func TestGroupVFsByDriverNoVFs(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPF("enp59s0f0", "0000:3b:00.0")
+
+	got, err := GroupVFsByDriver("enp59s0f0")
+	if err != nil {
+		t.Fatalf("GroupVFsByDriver() failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GroupVFsByDriver() = %v, want no groups", got)
+	}
+}
+
+func TestGetAllVFMacsSysfs(t *testing.T) {
+	tests := map[string]struct {
+		vfFiles map[int]map[string]string
+		want    map[int]string
+	}{
+		"mlx5 config dumps": {
+			vfFiles: map[int]map[string]string{
+				0: {"config": "VF         : 0\nMAC        : 02:AA:BB:CC:DD:00\nVLAN       : 0\n"},
+				1: {"config": "VF         : 1\nMAC        : 02:aa:bb:cc:dd:01\nVLAN       : 100\n"},
+				2: {"config": "VF         : 2\nMAC        : 00:00:00:00:00:00\nVLAN       : 0\n"},
+			},
+			want: map[int]string{0: "02:aa:bb:cc:dd:00", 1: "02:aa:bb:cc:dd:01"},
+		},
+		"per attribute files": {
+			vfFiles: map[int]map[string]string{
+				0:  {"mac": "02:aa:bb:cc:dd:00\n"},
+				1:  {"mac": "01:00:5e:00:00:01\n"},
+				10: {"mac": "02:aa:bb:cc:dd:0a\n"},
+			},
+			want: map[int]string{0: "02:aa:bb:cc:dd:00", 10: "02:aa:bb:cc:dd:0a"},
+		},
+		"no MAC assigned": {
+			vfFiles: map[int]map[string]string{
+				0: {"vlan": "100\n"},
+			},
+			want: map[int]string{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newSriovSysfs(t)
+			sriovDir := filepath.Join(NetDirectory, "enp59s0f0", "device", "sriov")
+			for vfID, files := range tt.vfFiles {
+				for file, content := range files {
+					f.writeFile(filepath.Join(sriovDir, strconv.Itoa(vfID), file), content)
+				}
+			}
+			// not a VF directory
+			f.writeFile(filepath.Join(sriovDir, "link_state"), "auto\n")
+			// the sysfs tree is used, netlink is not needed
+			fake := newFakeNetlink(t)
+			fake.errs["LinkByName"] = syscall.EOPNOTSUPP
+
+			got, err := GetAllVFMacsSysfs("enp59s0f0")
+			if err != nil {
+				t.Fatalf("GetAllVFMacsSysfs() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAllVFMacsSysfs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllVFMacsSysfsNetlinkFallback(t *testing.T) {
+	newSriovSysfs(t)
+	pf := newFakePF("enp59s0f0", 3)
+	pf.Vfs[0].Mac = net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x00}
+	pf.Vfs[2].Mac = net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x02}
+	newFakeNetlink(t, pf)
+
+	got, err := GetAllVFMacsSysfs("enp59s0f0")
+	if err != nil {
+		t.Fatalf("GetAllVFMacsSysfs() failed: %v", err)
+	}
+	want := map[int]string{0: "02:aa:bb:cc:dd:00", 2: "02:aa:bb:cc:dd:02"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllVFMacsSysfs() = %v, want %v", got, want)
+	}
+
+	if got, err := GetAllVFMacsSysfs("enp59s0f9"); err == nil {
+		t.Errorf("GetAllVFMacsSysfs() = %v for a missing PF, want error", got)
+	}
+	if got, err := GetAllVFMacsSysfs("../enp59s0f0"); err == nil {
+		t.Errorf("GetAllVFMacsSysfs() = %v for an invalid name, want error", got)
+	}
+}
+
+func TestRemoveAllVFs(t *testing.T) {
+	tests := map[string]struct {
+		setup      func(f *fakeSysfs)
+		force      bool
+		wantErr    error
+		wantNumVfs int
+	}{
+		"no VF in use": {
+			setup: func(f *fakeSysfs) {
+				f.bindDriver("0000:3b:02.1", "iavf")
+			},
+			wantNumVfs: 0,
+		},
+		"VF moved into a container": {
+			setup: func(f *fakeSysfs) {
+				f.bindDriver("0000:3b:02.0", "iavf")
+			},
+			wantErr:    ErrVFInUse,
+			wantNumVfs: 3,
+		},
+		"VF bound to a userspace driver": {
+			setup: func(f *fakeSysfs) {
+				f.bindDriver("0000:3b:02.2", "vfio-pci")
+			},
+			wantErr:    ErrVFInUse,
+			wantNumVfs: 3,
+		},
+		"forced with VFs in use": {
+			setup: func(f *fakeSysfs) {
+				f.bindDriver("0000:3b:02.0", "iavf")
+				f.bindDriver("0000:3b:02.2", "vfio-pci")
+			},
+			force:      true,
+			wantNumVfs: 0,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newSriovSysfs(t)
+			tt.setup(f)
+
+			err := RemoveAllVFs("enp59s0f0", tt.force)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RemoveAllVFs() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("RemoveAllVFs() failed: %v", err)
+			}
+
+			numVfs, err := GetSriovNumVfs("enp59s0f0")
+			if err != nil {
+				t.Fatalf("GetSriovNumVfs() failed: %v", err)
+			}
+			if numVfs != tt.wantNumVfs {
+				t.Errorf("sriov_numvfs = %d, want %d", numVfs, tt.wantNumVfs)
+			}
+		})
+	}
+}
+
+func TestRemoveAllVFsErrors(t *testing.T) {
+	newSriovSysfs(t)
+
+	for _, pfName := range []string{"enp59s0f9", "../enp59s0f0"} {
+		for _, force := range []bool{false, true} {
+			if err := RemoveAllVFs(pfName, force); err == nil {
+				t.Errorf("RemoveAllVFs(%q, %v) succeeded, want error", pfName, force)
+			}
+		}
+	}
+
+	failSysfsWrites(t, func(string) bool { return true }, syscall.EROFS)
+	if err := RemoveAllVFs("enp59s0f0", false); !errors.Is(err, ErrSysfsReadOnly) {
+		t.Errorf("RemoveAllVFs() error = %v, want %v", err, ErrSysfsReadOnly)
+	}
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNetdevStatsReset is returned when the counters of an interface went
+// backwards since the previous read, i.e. they were reset or wrapped
+var ErrNetdevStatsReset = errors.New("interface statistics were reset")
+
+// NetdevStats holds the sysfs statistics counters of a network device
+type NetdevStats struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// counters returns pointers to every counter so they can be handled
+// uniformly
+func (s *NetdevStats) counters() map[string]*uint64 {
+	return map[string]*uint64{
+		"rx_bytes":   &s.RxBytes,
+		"tx_bytes":   &s.TxBytes,
+		"rx_packets": &s.RxPackets,
+		"tx_packets": &s.TxPackets,
+		"rx_errors":  &s.RxErrors,
+		"tx_errors":  &s.TxErrors,
+		"rx_dropped": &s.RxDropped,
+		"tx_dropped": &s.TxDropped,
+	}
+}
+
+// GetNetdevStats reads the statistics counters of ifName from sysfs
+func GetNetdevStats(ifName string) (NetdevStats, error) {
+	if err := ValidateInterfaceName(ifName); err != nil {
+		return NetdevStats{}, err
+	}
+
+	var stats NetdevStats
+	statsDir := filepath.Join(NetDirectory, ifName, "statistics")
+	for name, counter := range stats.counters() {
+		data, err := os.ReadFile(filepath.Join(statsDir, name))
+		if err != nil {
+			return NetdevStats{}, fmt.Errorf("failed to read %s of %q: %w", name, ifName, err)
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return NetdevStats{}, fmt.Errorf("failed to parse %s of %q: %w", name, ifName, err)
+		}
+		*counter = value
+	}
+	return stats, nil
+}
+
+// ReadNetdevStatsDelta reads the current counters of ifName and returns them
+// along with the increase since prev. When any counter is lower than in prev
+// the counters were reset or wrapped: the delta is then the current value of
+// every counter and ErrNetdevStatsReset is returned with both results set.
+func ReadNetdevStatsDelta(ifName string, prev NetdevStats) (NetdevStats, NetdevStats, error) {
+	current, err := GetNetdevStats(ifName)
+	if err != nil {
+		return NetdevStats{}, NetdevStats{}, err
+	}
+
+	delta := current
+	prevCounters := prev.counters()
+	deltaCounters := delta.counters()
+	for name, cur := range current.counters() {
+		if *cur < *prevCounters[name] {
+			return current, current, fmt.Errorf("%s of %q went from %d to %d: %w",
+				name, ifName, *prevCounters[name], *cur, ErrNetdevStatsReset)
+		}
+		*deltaCounters[name] = *cur - *prevCounters[name]
+	}
+	return current, delta, nil
+}
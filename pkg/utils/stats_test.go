@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeNetdevStats writes the statistics counters of ifName in the fake tree
+func (f *fakeSysfs) writeNetdevStats(ifName string, stats NetdevStats) {
+	f.t.Helper()
+	statsDir := filepath.Join(NetDirectory, ifName, "statistics")
+	for name, counter := range stats.counters() {
+		f.writeFile(filepath.Join(statsDir, name), strconv.FormatUint(*counter, 10)+"\n")
+	}
+}
+
+func TestGetNetdevStats(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addNetdev("enp59s0f0", "0000:3b:00.0")
+	want := NetdevStats{RxBytes: 1 << 40, TxBytes: 2048, RxPackets: 10, TxPackets: 20, RxErrors: 1, TxErrors: 2, RxDropped: 3, TxDropped: 4}
+	f.writeNetdevStats("enp59s0f0", want)
+	f.addNetdev("enp59s0f1", "0000:3b:00.1")
+
+	got, err := GetNetdevStats("enp59s0f0")
+	if err != nil {
+		t.Fatalf("GetNetdevStats() failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("GetNetdevStats() = %+v, want %+v", got, want)
+	}
+
+	if _, err := GetNetdevStats("enp59s0f1"); err == nil {
+		t.Error("GetNetdevStats() succeeded for an interface without statistics, want error")
+	}
+}
+
+func TestReadNetdevStatsDelta(t *testing.T) {
+	prev := NetdevStats{RxBytes: 1000, TxBytes: 2000, RxPackets: 10, TxPackets: 20}
+
+	tests := map[string]struct {
+		current   NetdevStats
+		wantDelta NetdevStats
+		wantReset bool
+	}{
+		"counters increased": {
+			current:   NetdevStats{RxBytes: 1500, TxBytes: 2100, RxPackets: 15, TxPackets: 21, RxDropped: 1},
+			wantDelta: NetdevStats{RxBytes: 500, TxBytes: 100, RxPackets: 5, TxPackets: 1, RxDropped: 1},
+		},
+		"no traffic": {
+			current:   prev,
+			wantDelta: NetdevStats{},
+		},
+		"counters reset": {
+			current:   NetdevStats{RxBytes: 100, TxBytes: 50, RxPackets: 1, TxPackets: 1},
+			wantDelta: NetdevStats{RxBytes: 100, TxBytes: 50, RxPackets: 1, TxPackets: 1},
+			wantReset: true,
+		},
+		"one counter wrapped": {
+			current:   NetdevStats{RxBytes: 1500, TxBytes: 5, RxPackets: 15, TxPackets: 25},
+			wantDelta: NetdevStats{RxBytes: 1500, TxBytes: 5, RxPackets: 15, TxPackets: 25},
+			wantReset: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			f.addNetdev("enp59s0f0", "0000:3b:00.0")
+			f.writeNetdevStats("enp59s0f0", tt.current)
+
+			current, delta, err := ReadNetdevStatsDelta("enp59s0f0", prev)
+			if tt.wantReset {
+				if !errors.Is(err, ErrNetdevStatsReset) {
+					t.Errorf("ReadNetdevStatsDelta() error = %v, want %v", err, ErrNetdevStatsReset)
+				}
+			} else if err != nil {
+				t.Fatalf("ReadNetdevStatsDelta() failed: %v", err)
+			}
+			if current != tt.current {
+				t.Errorf("ReadNetdevStatsDelta() current = %+v, want %+v", current, tt.current)
+			}
+			if delta != tt.wantDelta {
+				t.Errorf("ReadNetdevStatsDelta() delta = %+v, want %+v", delta, tt.wantDelta)
+			}
+		})
+	}
+}
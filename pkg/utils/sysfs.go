@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// stRdonly is the ST_RDONLY mount flag reported by statfs
+const stRdonly = 0x1
+
+// ErrSysfsReadOnly is returned when a sysfs write fails because sysfs is
+// mounted read-only
+var ErrSysfsReadOnly = errors.New("sysfs is read-only")
+
+// openSysfsFile opens a sysfs attribute for writing, a variable so tests can
+// simulate a read-only sysfs
+var openSysfsFile = os.OpenFile
+
+// IsSysfsWritable reports whether the filesystem backing NetDirectory is
+// mounted read-write
+func IsSysfsWritable() (bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(NetDirectory, &st); err != nil {
+		return false, fmt.Errorf("failed to stat filesystem of %q: %w", NetDirectory, err)
+	}
+	return st.Flags&stRdonly == 0, nil
+}
+
+// writeSysfsFile writes value to a sysfs attribute, wrapping EROFS failures
+// with ErrSysfsReadOnly so callers can detect a locked down environment
+func writeSysfsFile(path, value string) error {
+	f, err := openSysfsFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err == nil {
+		_, err = f.WriteString(value)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		if errors.Is(err, syscall.EROFS) {
+			return fmt.Errorf("failed to write %q to %q: %w", value, path, ErrSysfsReadOnly)
+		}
+		return fmt.Errorf("failed to write %q to %q: %w", value, path, err)
+	}
+	return nil
+}
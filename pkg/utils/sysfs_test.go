@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// failSysfsWrites makes every sysfs write whose path matches fail with errno
+// until the test ends
+func failSysfsWrites(t *testing.T, match func(path string) bool, errno syscall.Errno) {
+	t.Helper()
+
+	saved := openSysfsFile
+	t.Cleanup(func() { openSysfsFile = saved })
+	openSysfsFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if match(name) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errno}
+		}
+		return saved(name, flag, perm)
+	}
+}
+
+func TestIsSysfsWritable(t *testing.T) {
+	newFakeSysfs(t)
+
+	writable, err := IsSysfsWritable()
+	if err != nil {
+		t.Fatalf("IsSysfsWritable() failed: %v", err)
+	}
+	if !writable {
+		t.Error("IsSysfsWritable() = false for a writable temporary directory")
+	}
+
+	NetDirectory = filepath.Join(t.TempDir(), "missing")
+	if _, err := IsSysfsWritable(); err == nil {
+		t.Error("IsSysfsWritable() succeeded for a missing directory")
+	}
+}
+
+func TestWriteSysfsFile(t *testing.T) {
+	f := newFakeSysfs(t)
+	attr := f.path("sys", "bus", "pci", "devices", "0000:3b:02.0", "driver_override")
+	f.writeFile(attr, "(null)\n")
+
+	tests := map[string]struct {
+		path     string
+		errno    syscall.Errno
+		wantErr  bool
+		readOnly bool
+	}{
+		"write":            {path: attr},
+		"missing file":     {path: attr + "_missing", wantErr: true},
+		"read-only sysfs":  {path: attr, errno: syscall.EROFS, wantErr: true, readOnly: true},
+		"permission error": {path: attr, errno: syscall.EACCES, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.errno != 0 {
+				failSysfsWrites(t, func(string) bool { return true }, tt.errno)
+			}
+
+			err := writeSysfsFile(tt.path, "vfio-pci")
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("writeSysfsFile() failed: %v", err)
+				}
+				data, err := os.ReadFile(tt.path)
+				if err != nil {
+					t.Fatalf("failed to read %q: %v", tt.path, err)
+				}
+				if string(data) != "vfio-pci" {
+					t.Errorf("file content = %q, want %q", data, "vfio-pci")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("writeSysfsFile() succeeded, want error")
+			}
+			if got := errors.Is(err, ErrSysfsReadOnly); got != tt.readOnly {
+				t.Errorf("errors.Is(%v, ErrSysfsReadOnly) = %v, want %v", err, got, tt.readOnly)
+			}
+			if tt.errno != 0 && !errors.Is(err, tt.errno) && !tt.readOnly {
+				t.Errorf("error %v does not wrap %v", err, tt.errno)
+			}
+		})
+	}
+}
+
+func TestSetDriverOverrideReadOnly(t *testing.T) {
+	f := newFakeSysfs(t)
+	f.addPciDevice("0000:3b:02.0", map[string]string{"driver_override": "(null)\n"})
+	failSysfsWrites(t, func(string) bool { return true }, syscall.EROFS)
+
+	err := SetDriverOverride("0000:3b:02.0", "vfio-pci")
+	if !errors.Is(err, ErrSysfsReadOnly) {
+		t.Errorf("SetDriverOverride() error = %v, want %v", err, ErrSysfsReadOnly)
+	}
+}
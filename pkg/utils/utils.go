@@ -0,0 +1,364 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package utils contains host side helpers used by the gateway-evpn-cni
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// NetDirectory is the sysfs net directory
+	NetDirectory = "/sys/class/net"
+	// SysBusPci is the sysfs pci device directory
+	SysBusPci = "/sys/bus/pci/devices"
+	// SysKernelIommuGroups is the sysfs iommu groups directory
+	SysKernelIommuGroups = "/sys/kernel/iommu_groups"
+	// ProcIrq is the procfs irq directory
+	ProcIrq = "/proc/irq"
+	// HostNetns is the network namespace of the host, that of pid 1
+	HostNetns = "/proc/1/ns/net"
+	// ProcKernelOsRelease is the procfs file holding the kernel release
+	ProcKernelOsRelease = "/proc/sys/kernel/osrelease"
+)
+
+// kernelVersionRe matches the numeric prefix of a kernel release string
+var kernelVersionRe = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Config holds the effective host paths used by the package
+type Config struct {
+	NetDirectory         string `json:"netDirectory"`
+	SysBusPci            string `json:"sysBusPci"`
+	SysKernelIommuGroups string `json:"sysKernelIommuGroups"`
+	ProcIrq              string `json:"procIrq"`
+	HostNetns            string `json:"hostNetns"`
+	ProcKernelOsRelease  string `json:"procKernelOsRelease"`
+}
+
+// EffectiveConfig returns the host paths currently in use, including any
+// override of the package defaults
+func EffectiveConfig() Config {
+	return Config{
+		NetDirectory:         NetDirectory,
+		SysBusPci:            SysBusPci,
+		SysKernelIommuGroups: SysKernelIommuGroups,
+		ProcIrq:              ProcIrq,
+		HostNetns:            HostNetns,
+		ProcKernelOsRelease:  ProcKernelOsRelease,
+	}
+}
+
+// IsValidMACAddress checks if net.HardwareAddr is a valid unicast MAC address
+func IsValidMACAddress(addr net.HardwareAddr) bool {
+	invalidMACAddresses := [][]byte{
+		{0, 0, 0, 0, 0, 0},
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	if len(addr) != 6 {
+		return false
+	}
+	for _, invalidMACAddress := range invalidMACAddresses {
+		if bytes.Equal(addr, invalidMACAddress) {
+			return false
+		}
+	}
+	// the I/G bit marks a multicast (group) address
+	return addr[0]&0x01 == 0
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it in place so readers never observe a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %q: %w", dir, err)
+	}
+	tmpName := tmp.Name()
+	// a no-op once the file has been renamed in place
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %q: %w", tmpName, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync %q: %w", tmpName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %q: %w", tmpName, err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("failed to set permissions on %q: %w", tmpName, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to rename %q to %q: %w", tmpName, path, err)
+	}
+	return nil
+}
+
+// lockFile takes an exclusive flock on path, creating it if needed, and
+// returns a function releasing the lock. With remove set the release also
+// deletes the lock file; a waiter that locked the deleted file notices it is
+// no longer the one at path and tries again.
+func lockFile(path string, remove bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory for lock file %q: %w", path, err)
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file %q: %w", path, err)
+		}
+
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %q: %w", path, err)
+		}
+
+		locked, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to stat lock file %q: %w", path, err)
+		}
+		current, err := os.Stat(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to stat lock file %q: %w", path, err)
+		}
+		if err != nil || !os.SameFile(locked, current) {
+			// the previous holder removed the file while we waited
+			_ = f.Close()
+			continue
+		}
+
+		return func() {
+			if remove {
+				_ = os.Remove(path)
+			}
+			_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			_ = f.Close()
+		}, nil
+	}
+}
+
+// getFileNamesFromPath returns the names of the entries of dir
+func getFileNamesFromPath(dir string) ([]string, error) {
+	if _, err := os.Lstat(dir); err != nil {
+		return nil, fmt.Errorf("could not stat the directory %q: %w", dir, err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %q: %w", dir, err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSpace(file.Name()))
+	}
+	return names, nil
+}
+
+// multiError is a combination of errors. errors.Is and errors.As match any
+// of them, which errors.Join would provide from Go 1.20 on.
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e multiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e multiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors combines errs into a single error, returning nil when errs is
+// empty
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return multiError(errs)
+}
+
+// ParseCIDRs parses a list of CIDR strings, preserving their order. The
+// first malformed entry is reported together with its position.
+func ParseCIDRs(ss []string) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, 0, len(ss))
+	for i, s := range ss {
+		_, cidr, err := net.ParseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q at index %d: %w", s, i, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// pollInterval is the delay between two checks of a polled condition
+const pollInterval = 100 * time.Millisecond
+
+// errPollTimeout is returned by pollUntil when the condition was not met in
+// time
+var errPollTimeout = errors.New("timed out")
+
+// pollUntil calls cond every pollInterval until it returns true or an error,
+// or until timeout elapses. The condition is always checked at least once.
+func pollUntil(timeout time.Duration, cond func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := cond()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errPollTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// SysfsConcurrency is the number of devices the list functions read in
+// parallel, GOMAXPROCS when not positive
+var SysfsConcurrency = 0
+
+// forEachConcurrently calls fn for every index in [0, n), running at most
+// SysfsConcurrency calls at a time. Callers store the result for index i at
+// position i, so the output order does not depend on the scheduling. Once
+// ctx is done the remaining indexes are skipped; callers check ctx.Err().
+func forEachConcurrently(ctx context.Context, n int, fn func(i int)) {
+	workers := SysfsConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() == nil {
+					fn(i)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// LinkLocalFromMAC returns the EUI-64 based IPv6 link-local address the
+// kernel derives from mac
+func LinkLocalFromMAC(mac net.HardwareAddr) (net.IP, error) {
+	if !IsValidMACAddress(mac) {
+		return nil, fmt.Errorf("invalid MAC address %q", mac)
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfe
+	ip[1] = 0x80
+	ip[8] = mac[0] ^ 0x02
+	ip[9] = mac[1]
+	ip[10] = mac[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = mac[3]
+	ip[14] = mac[4]
+	ip[15] = mac[5]
+	return ip, nil
+}
+
+// DeterministicMAC derives a stable MAC address from the pod identity so a
+// restarted pod keeps its address. The result is a locally administered
+// unicast address and therefore always passes IsValidMACAddress.
+func DeterministicMAC(namespace, podName, ifName string) net.HardwareAddr {
+	sum := sha256.Sum256([]byte(namespace + "/" + podName + "/" + ifName))
+
+	mac := make(net.HardwareAddr, 6)
+	copy(mac, sum[:6])
+	// set the locally administered bit and clear the multicast bit
+	mac[0] = (mac[0] | 0x02) &^ 0x01
+	return mac
+}
+
+// parseKernelVersion extracts the version numbers from a kernel release such
+// as "5.15.0-91-generic"
+func parseKernelVersion(release string) (major, minor, patch int, err error) {
+	m := kernelVersionRe.FindStringSubmatch(strings.TrimSpace(release))
+	if m == nil {
+		return 0, 0, 0, fmt.Errorf("invalid kernel release %q", release)
+	}
+
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		patch, _ = strconv.Atoi(m[3])
+	}
+	return major, minor, patch, nil
+}
+
+// GetKernelVersion returns the version of the running kernel
+func GetKernelVersion() (major, minor, patch int, err error) {
+	data, err := os.ReadFile(ProcKernelOsRelease)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to read kernel release: %w", err)
+	}
+	return parseKernelVersion(string(data))
+}
@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsValidMACAddress(t *testing.T) {
+	tests := map[string]struct {
+		mac  net.HardwareAddr
+		want bool
+	}{
+		"unicast":                        {mac: net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55}, want: true},
+		"universal unicast":              {mac: net.HardwareAddr{0x00, 0x1b, 0x21, 0xaa, 0xbb, 0xcc}, want: true},
+		"all zero":                       {mac: net.HardwareAddr{0, 0, 0, 0, 0, 0}, want: false},
+		"broadcast":                      {mac: net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: false},
+		"multicast":                      {mac: net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01}, want: false},
+		"locally administered multicast": {mac: net.HardwareAddr{0x03, 0x11, 0x22, 0x33, 0x44, 0x55}, want: false},
+		"too short":                      {mac: net.HardwareAddr{0x02, 0x11, 0x22}, want: false},
+		"infiniband length":              {mac: make(net.HardwareAddr, 20), want: false},
+		"nil":                            {mac: nil, want: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsValidMACAddress(tt.mac); got != tt.want {
+				t.Errorf("IsValidMACAddress(%v) = %v, want %v", tt.mac, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	if err := joinErrors(nil); err != nil {
+		t.Errorf("joinErrors(nil) = %v, want nil", err)
+	}
+
+	pathErr := &fs.PathError{Op: "write", Path: "/sys/bus/pci/drivers/iavf/unbind", Err: syscall.EROFS}
+	err := joinErrors([]error{
+		fmt.Errorf("failed to unbind: %w", pathErr),
+		fmt.Errorf("failed to restore override: %w", os.ErrNotExist),
+	})
+
+	want := "failed to unbind: write /sys/bus/pci/drivers/iavf/unbind: read-only file system; failed to restore override: file does not exist"
+	if err.Error() != want {
+		t.Errorf("joinErrors() = %q, want %q", err, want)
+	}
+	for _, target := range []error{syscall.EROFS, os.ErrNotExist} {
+		if !errors.Is(err, target) {
+			t.Errorf("errors.Is(joinErrors(), %v) = false, want true", target)
+		}
+	}
+	if errors.Is(err, os.ErrPermission) {
+		t.Errorf("errors.Is(joinErrors(), %v) = true, want false", os.ErrPermission)
+	}
+
+	var gotPathErr *fs.PathError
+	if !errors.As(fmt.Errorf("wrapped: %w", err), &gotPathErr) || gotPathErr != pathErr {
+		t.Errorf("errors.As(joinErrors()) = %v, want %v", gotPathErr, pathErr)
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	tests := map[string]struct {
+		ss      []string
+		want    []string
+		wantErr bool
+	}{
+		"mixed v4 and v6": {
+			ss:   []string{"10.0.0.0/8", "2001:db8::/32", " 192.168.1.7/24 ", "fd00::1/128"},
+			want: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.0/24", "fd00::1/128"},
+		},
+		"empty list":    {ss: []string{}, want: []string{}},
+		"one bad entry": {ss: []string{"10.0.0.0/8", "10.0.0.0/33", "2001:db8::/32"}, wantErr: true},
+		"address only":  {ss: []string{"10.0.0.1"}, wantErr: true},
+		"empty entry":   {ss: []string{""}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseCIDRs(tt.ss)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseCIDRs(%q) = %v, want error", tt.ss, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCIDRs(%q) failed: %v", tt.ss, err)
+			}
+			gotStrs := make([]string, 0, len(got))
+			for _, cidr := range got {
+				gotStrs = append(gotStrs, cidr.String())
+			}
+			if !reflect.DeepEqual(gotStrs, tt.want) {
+				t.Errorf("ParseCIDRs(%q) = %v, want %v", tt.ss, gotStrs, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRsReportsEntry(t *testing.T) {
+	_, err := ParseCIDRs([]string{"10.0.0.0/8", "10.0.0.0/33"})
+	if err == nil || !strings.Contains(err.Error(), `"10.0.0.0/33"`) || !strings.Contains(err.Error(), "index 1") {
+		t.Errorf("ParseCIDRs() error = %v, want it to name the bad entry and its index", err)
+	}
+}
+
+func TestLinkLocalFromMAC(t *testing.T) {
+	tests := map[string]struct {
+		mac     net.HardwareAddr
+		want    string
+		wantErr bool
+	}{
+		"universal MAC":      {mac: net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}, want: "fe80::5054:ff:fe12:3456"},
+		"local MAC":          {mac: net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}, want: "fe80::aa:bbff:fecc:dd01"},
+		"U/L bit flipped on": {mac: net.HardwareAddr{0x00, 0x1b, 0x21, 0xaa, 0xbb, 0xcc}, want: "fe80::21b:21ff:feaa:bbcc"},
+		"zero MAC":           {mac: net.HardwareAddr{0, 0, 0, 0, 0, 0}, wantErr: true},
+		"multicast MAC":      {mac: net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := LinkLocalFromMAC(tt.mac)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LinkLocalFromMAC(%v) = %v, want error", tt.mac, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LinkLocalFromMAC(%v) failed: %v", tt.mac, err)
+			}
+			if !got.Equal(net.ParseIP(tt.want)) || !got.IsLinkLocalUnicast() {
+				t.Errorf("LinkLocalFromMAC(%v) = %v, want %s", tt.mac, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeterministicMAC(t *testing.T) {
+	// pinned so a change of the derivation, which would renumber every pod
+	// on upgrade, does not go unnoticed
+	if got, want := DeterministicMAC("default", "web-0", "net1").String(), "56:2d:21:3a:73:45"; got != want {
+		t.Errorf("DeterministicMAC(default, web-0, net1) = %s, want %s", got, want)
+	}
+
+	seen := map[string]string{}
+	for _, ns := range []string{"default", "kube-system", "tenant-a"} {
+		for _, pod := range []string{"web-0", "web-1", "db-0"} {
+			for _, ifName := range []string{"net1", "net2"} {
+				identity := ns + "/" + pod + "/" + ifName
+				mac := DeterministicMAC(ns, pod, ifName)
+				if again := DeterministicMAC(ns, pod, ifName); !bytes.Equal(again, mac) {
+					t.Errorf("DeterministicMAC(%s) not stable: %s then %s", identity, mac, again)
+				}
+				if !IsValidMACAddress(mac) {
+					t.Errorf("DeterministicMAC(%s) = %s, not a valid unicast MAC", identity, mac)
+				}
+				if mac[0]&0x02 == 0 {
+					t.Errorf("DeterministicMAC(%s) = %s, locally administered bit not set", identity, mac)
+				}
+				if mac[0]&0x01 != 0 {
+					t.Errorf("DeterministicMAC(%s) = %s, multicast bit set", identity, mac)
+				}
+				if other, dup := seen[mac.String()]; dup {
+					t.Errorf("DeterministicMAC(%s) = %s, same as %s", identity, mac, other)
+				}
+				seen[mac.String()] = identity
+			}
+		}
+	}
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	want := Config{
+		NetDirectory:         "/sys/class/net",
+		SysBusPci:            "/sys/bus/pci/devices",
+		SysKernelIommuGroups: "/sys/kernel/iommu_groups",
+		ProcIrq:              "/proc/irq",
+		HostNetns:            "/proc/1/ns/net",
+		ProcKernelOsRelease:  "/proc/sys/kernel/osrelease",
+	}
+	if got := EffectiveConfig(); got != want {
+		t.Errorf("EffectiveConfig() = %+v, want the defaults %+v", got, want)
+	}
+
+	f := newFakeSysfs(t)
+	got := EffectiveConfig()
+	if got.NetDirectory != f.path("sys", "class", "net") || got.SysBusPci != f.path("sys", "bus", "pci", "devices") {
+		t.Errorf("EffectiveConfig() = %+v, want the overridden paths", got)
+	}
+	if got.HostNetns != want.HostNetns {
+		t.Errorf("EffectiveConfig().HostNetns = %q, want the default %q", got.HostNetns, want.HostNetns)
+	}
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	tests := map[string]struct {
+		concurrency int
+		n           int
+		wantMax     int32
+	}{
+		"serial":              {concurrency: 1, n: 20, wantMax: 1},
+		"bounded":             {concurrency: 4, n: 20, wantMax: 4},
+		"more workers than n": {concurrency: 8, n: 3, wantMax: 3},
+		"GOMAXPROCS default":  {concurrency: 0, n: 20, wantMax: int32(runtime.GOMAXPROCS(0))},
+		"no work":             {concurrency: 4, n: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			saved := SysfsConcurrency
+			t.Cleanup(func() { SysfsConcurrency = saved })
+			SysfsConcurrency = tt.concurrency
+
+			var running, maxRunning int32
+			got := make([]int, tt.n)
+			forEachConcurrently(context.Background(), tt.n, func(i int) {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				got[i] = i * i
+				atomic.AddInt32(&running, -1)
+			})
+
+			for i, v := range got {
+				if v != i*i {
+					t.Errorf("result %d = %d, want %d", i, v, i*i)
+				}
+			}
+			if maxRunning > tt.wantMax {
+				t.Errorf("%d calls ran at once, want at most %d", maxRunning, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestGetKernelVersion(t *testing.T) {
+	tests := map[string]struct {
+		release                         string
+		wantMajor, wantMinor, wantPatch int
+		wantErr                         bool
+	}{
+		"ubuntu":            {release: "5.15.0-91-generic\n", wantMajor: 5, wantMinor: 15},
+		"rhel":              {release: "4.18.0-513.5.1.el8_9.x86_64\n", wantMajor: 4, wantMinor: 18},
+		"fedora":            {release: "6.6.8-200.fc39.x86_64\n", wantMajor: 6, wantMinor: 6, wantPatch: 8},
+		"vanilla":           {release: "6.1.69\n", wantMajor: 6, wantMinor: 1, wantPatch: 69},
+		"release candidate": {release: "6.8.0-rc3\n", wantMajor: 6, wantMinor: 8},
+		"no patch level":    {release: "6.7-rc1+\n", wantMajor: 6, wantMinor: 7},
+		"amazon linux":      {release: "5.10.205-195.804.amzn2.x86_64\n", wantMajor: 5, wantMinor: 10, wantPatch: 205},
+		"major only":        {release: "6\n", wantErr: true},
+		"garbage":           {release: "generic\n", wantErr: true},
+		"empty":             {release: "", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSysfs(t)
+			f.writeFile(ProcKernelOsRelease, tt.release)
+
+			major, minor, patch, err := GetKernelVersion()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetKernelVersion() for %q = %d.%d.%d, want error", tt.release, major, minor, patch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetKernelVersion() for %q failed: %v", tt.release, err)
+			}
+			if major != tt.wantMajor || minor != tt.wantMinor || patch != tt.wantPatch {
+				t.Errorf("GetKernelVersion() for %q = %d.%d.%d, want %d.%d.%d",
+					tt.release, major, minor, patch, tt.wantMajor, tt.wantMinor, tt.wantPatch)
+			}
+		})
+	}
+}
+
+func TestGetKernelVersionMissing(t *testing.T) {
+	newFakeSysfs(t)
+
+	if _, _, _, err := GetKernelVersion(); err == nil {
+		t.Error("GetKernelVersion() succeeded without osrelease, want error")
+	}
+}
@@ -0,0 +1,352 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// maxVFTrafficClass is the highest 802.1p priority a VF can be tagged with
+const maxVFTrafficClass = 7
+
+// maxVlanID is the highest valid 802.1Q VLAN ID
+const maxVlanID = 4095
+
+// vlanProtos maps the supported VLAN protocol names to their ethertype
+var vlanProtos = map[string]int{
+	"802.1Q":  int(netlink.VLAN_PROTOCOL_8021Q),
+	"802.1ad": int(netlink.VLAN_PROTOCOL_8021AD),
+}
+
+// ErrVFTrafficClassUnsupported is returned when the traffic class of a VF
+// can not be configured on the device
+var ErrVFTrafficClassUnsupported = errors.New("VF traffic class is not supported")
+
+// getVfInfo returns the PF link and the netlink VF info of VF vfID on pfName
+func getVfInfo(pfName string, vfID int) (netlink.Link, *netlink.VfInfo, error) {
+	pfLink, err := netlinkOps.LinkByName(pfName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lookup PF %q: %w", pfName, err)
+	}
+
+	for i := range pfLink.Attrs().Vfs {
+		if pfLink.Attrs().Vfs[i].ID == vfID {
+			return pfLink, &pfLink.Attrs().Vfs[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("VF %d not found on PF %q", vfID, pfName)
+}
+
+// GetVFRate returns the min and max tx rate in Mbps configured for VF vfID
+// on pfName. A value of 0 means no limit.
+func GetVFRate(pfName string, vfID int) (min, max int, err error) {
+	_, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	max = int(vf.MaxTxRate)
+	if max == 0 {
+		// drivers without IFLA_VF_RATE only report the legacy tx rate
+		max = vf.TxRate
+	}
+	return int(vf.MinTxRate), max, nil
+}
+
+// SetVFRate sets the min and max tx rate in Mbps of VF vfID on pfName.
+// A value of 0 removes the corresponding limit.
+func SetVFRate(pfName string, vfID int, minTxRate, maxTxRate int) error {
+	if minTxRate < 0 || maxTxRate < 0 {
+		return fmt.Errorf("invalid tx rate min %d max %d: rates must be non-negative", minTxRate, maxTxRate)
+	}
+	if maxTxRate != 0 && minTxRate > maxTxRate {
+		return fmt.Errorf("invalid tx rate: min %d is greater than max %d", minTxRate, maxTxRate)
+	}
+
+	pfLink, _, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return err
+	}
+
+	err = netlinkOps.LinkSetVfRate(pfLink, vfID, minTxRate, maxTxRate)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EOPNOTSUPP) {
+		return fmt.Errorf("failed to set tx rate of VF %d on PF %q: %w", vfID, pfName, err)
+	}
+	if minTxRate != 0 {
+		return fmt.Errorf("driver of PF %q does not support min_tx_rate for VF %d: %w", pfName, vfID, err)
+	}
+
+	// older drivers only implement the legacy max tx rate attribute
+	if err := netlinkOps.LinkSetVfTxRate(pfLink, vfID, maxTxRate); err != nil {
+		return fmt.Errorf("failed to set max tx rate of VF %d on PF %q: %w", vfID, pfName, err)
+	}
+	return nil
+}
+
+// vfVlanProto returns the VLAN protocol of the port VLAN of vf, kernels not
+// reporting it only supporting 802.1Q
+func vfVlanProto(vf netlink.VfInfo) int {
+	if vf.VlanProto == 0 {
+		return int(netlink.VLAN_PROTOCOL_8021Q)
+	}
+	return vf.VlanProto
+}
+
+// SetVFTrafficClass maps the traffic of VF vfID on pfName to the traffic
+// class tc. The kernel has no generic per VF traffic class attribute, so the
+// class is applied as the 802.1p priority of the VF's port VLAN; a VF
+// without a port VLAN or a driver refusing the priority is unsupported.
+func SetVFTrafficClass(pfName string, vfID int, tc int) error {
+	if tc < 0 || tc > maxVFTrafficClass {
+		return fmt.Errorf("invalid traffic class %d: must be between 0 and %d", tc, maxVFTrafficClass)
+	}
+
+	pfLink, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return err
+	}
+	if vf.Vlan == 0 {
+		return fmt.Errorf("VF %d on PF %q has no VLAN to carry a traffic class: %w", vfID, pfName, ErrVFTrafficClassUnsupported)
+	}
+
+	if err := netlinkOps.LinkSetVfVlanQosProto(pfLink, vfID, vf.Vlan, tc, vfVlanProto(*vf)); err != nil {
+		if errors.Is(err, syscall.EOPNOTSUPP) {
+			return fmt.Errorf("driver of PF %q can not set traffic class of VF %d: %w", pfName, vfID, ErrVFTrafficClassUnsupported)
+		}
+		return fmt.Errorf("failed to set traffic class of VF %d on PF %q: %w", vfID, pfName, err)
+	}
+	return nil
+}
+
+// ResetAllVFs restores the administrative defaults of every VF on pfName:
+// zero MAC, no VLAN, spoof checking on and trust off. Every VF is attempted
+// and the failures are returned combined.
+func ResetAllVFs(pfName string) error {
+	pfLink, err := netlinkOps.LinkByName(pfName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup PF %q: %w", pfName, err)
+	}
+
+	zeroMac := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	var errs []error
+	for _, vf := range pfLink.Attrs().Vfs {
+		if err := netlinkOps.LinkSetVfHardwareAddr(pfLink, vf.ID, zeroMac); err != nil {
+			errs = append(errs, fmt.Errorf("failed to reset MAC of VF %d: %w", vf.ID, err))
+		}
+		if err := netlinkOps.LinkSetVfVlanQos(pfLink, vf.ID, 0, 0); err != nil {
+			errs = append(errs, fmt.Errorf("failed to reset VLAN of VF %d: %w", vf.ID, err))
+		}
+		if err := netlinkOps.LinkSetVfSpoofchk(pfLink, vf.ID, true); err != nil {
+			errs = append(errs, fmt.Errorf("failed to enable spoofchk of VF %d: %w", vf.ID, err))
+		}
+		if err := netlinkOps.LinkSetVfTrust(pfLink, vf.ID, false); err != nil {
+			errs = append(errs, fmt.Errorf("failed to disable trust of VF %d: %w", vf.ID, err))
+		}
+	}
+
+	if err := joinErrors(errs); err != nil {
+		return fmt.Errorf("failed to reset VFs of PF %q: %w", pfName, err)
+	}
+	return nil
+}
+
+// SetVFMacIfUnset sets the administrative MAC of VF vfID on pfName to mac
+// only when the VF has no MAC assigned yet, and reports whether it changed
+func SetVFMacIfUnset(pfName string, vfID int, mac net.HardwareAddr) (bool, error) {
+	if !IsValidMACAddress(mac) {
+		return false, fmt.Errorf("invalid MAC address %q", mac)
+	}
+
+	pfLink, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return false, err
+	}
+	if len(vf.Mac) != 0 && !bytes.Equal(vf.Mac, make(net.HardwareAddr, len(vf.Mac))) {
+		return false, nil
+	}
+
+	if err := netlinkOps.LinkSetVfHardwareAddr(pfLink, vfID, mac); err != nil {
+		return false, fmt.Errorf("failed to set MAC %q of VF %d on PF %q: %w", mac, vfID, pfName, err)
+	}
+	return true, nil
+}
+
+// IsMacInUse reports whether mac is already assigned as the administrative
+// MAC of any VF on the node, and if so which one as "<pf> vf <id>"
+func IsMacInUse(mac net.HardwareAddr) (bool, string, error) {
+	if !IsValidMACAddress(mac) {
+		return false, "", fmt.Errorf("invalid MAC address %q", mac)
+	}
+
+	links, err := netlinkOps.LinkList()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to list links: %w", err)
+	}
+
+	for _, link := range links {
+		for _, vf := range link.Attrs().Vfs {
+			if bytes.Equal(vf.Mac, mac) {
+				return true, fmt.Sprintf("%s vf %d", link.Attrs().Name, vf.ID), nil
+			}
+		}
+	}
+	return false, "", nil
+}
+
+// VFConfig is the administrative configuration of a VF as set on its PF
+type VFConfig struct {
+	MAC  string `json:"mac,omitempty"`
+	Vlan int    `json:"vlan"`
+	Qos  int    `json:"qos"`
+	// VlanProto is the ethertype of the port VLAN, 0 meaning 802.1Q
+	VlanProto int    `json:"vlanProto"`
+	MinTxRate int    `json:"minTxRate"`
+	MaxTxRate int    `json:"maxTxRate"`
+	SpoofChk  bool   `json:"spoofchk"`
+	Trust     bool   `json:"trust"`
+	LinkState uint32 `json:"linkState"`
+}
+
+// SnapshotVFConfig captures the administrative configuration of VF vfID on
+// pfName so it can later be restored with ApplyVFConfig
+func SnapshotVFConfig(pfName string, vfID int) (VFConfig, error) {
+	_, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return VFConfig{}, err
+	}
+
+	cfg := VFConfig{
+		Vlan:      vf.Vlan,
+		Qos:       vf.Qos,
+		VlanProto: vfVlanProto(*vf),
+		MinTxRate: int(vf.MinTxRate),
+		MaxTxRate: int(vf.MaxTxRate),
+		SpoofChk:  vf.Spoofchk,
+		Trust:     vf.Trust != 0,
+		LinkState: vf.LinkState,
+	}
+	if cfg.MaxTxRate == 0 {
+		cfg.MaxTxRate = vf.TxRate
+	}
+	if len(vf.Mac) != 0 {
+		cfg.MAC = vf.Mac.String()
+	}
+	return cfg, nil
+}
+
+// ApplyVFConfig applies cfg to VF vfID on pfName. Every setting is attempted
+// and the failures are returned combined.
+func ApplyVFConfig(pfName string, vfID int, cfg VFConfig) error {
+	var mac net.HardwareAddr
+	if cfg.MAC != "" {
+		var err error
+		if mac, err = net.ParseMAC(cfg.MAC); err != nil {
+			return fmt.Errorf("invalid MAC address %q: %w", cfg.MAC, err)
+		}
+	}
+
+	pfLink, _, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if mac != nil {
+		if err := netlinkOps.LinkSetVfHardwareAddr(pfLink, vfID, mac); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set MAC: %w", err))
+		}
+	}
+	vlanProto := cfg.VlanProto
+	if vlanProto == 0 {
+		vlanProto = int(netlink.VLAN_PROTOCOL_8021Q)
+	}
+	if err := netlinkOps.LinkSetVfVlanQosProto(pfLink, vfID, cfg.Vlan, cfg.Qos, vlanProto); err != nil {
+		errs = append(errs, fmt.Errorf("failed to set VLAN: %w", err))
+	}
+	if err := SetVFRate(pfName, vfID, cfg.MinTxRate, cfg.MaxTxRate); err != nil {
+		errs = append(errs, err)
+	}
+	if err := netlinkOps.LinkSetVfSpoofchk(pfLink, vfID, cfg.SpoofChk); err != nil {
+		errs = append(errs, fmt.Errorf("failed to set spoofchk: %w", err))
+	}
+	if err := netlinkOps.LinkSetVfTrust(pfLink, vfID, cfg.Trust); err != nil {
+		errs = append(errs, fmt.Errorf("failed to set trust: %w", err))
+	}
+	if err := netlinkOps.LinkSetVfState(pfLink, vfID, cfg.LinkState); err != nil {
+		errs = append(errs, fmt.Errorf("failed to set link state: %w", err))
+	}
+
+	if err := joinErrors(errs); err != nil {
+		return fmt.Errorf("failed to apply config of VF %d on PF %q: %w", vfID, pfName, err)
+	}
+	return nil
+}
+
+// GetVFSpoofCheck reports whether spoof checking is enabled for VF vfID on
+// pfName
+func GetVFSpoofCheck(pfName string, vfID int) (bool, error) {
+	_, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return false, err
+	}
+	return vf.Spoofchk, nil
+}
+
+// GetVFTrust reports whether VF vfID on pfName is trusted
+func GetVFTrust(pfName string, vfID int) (bool, error) {
+	_, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return false, err
+	}
+	return vf.Trust != 0, nil
+}
+
+// GetVFVlan returns the port VLAN and QoS of VF vfID on pfName, both 0 for
+// an untagged VF
+func GetVFVlan(pfName string, vfID int) (vlan, qos int, err error) {
+	_, vf, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return vf.Vlan, vf.Qos, nil
+}
+
+// SetVFVlanProto sets the port VLAN, QoS and VLAN protocol ("802.1Q" or
+// "802.1ad") of VF vfID on pfName. 802.1ad (QinQ) port VLANs are only
+// implemented by some drivers (e.g. mlx5, ice); others reject them.
+func SetVFVlanProto(pfName string, vfID int, vlan, qos int, proto string) error {
+	vlanProto, ok := vlanProtos[proto]
+	if !ok {
+		return fmt.Errorf("invalid VLAN protocol %q: must be 802.1Q or 802.1ad", proto)
+	}
+	if vlan < 0 || vlan > maxVlanID {
+		return fmt.Errorf("invalid VLAN %d: must be between 0 and %d", vlan, maxVlanID)
+	}
+	if qos < 0 || qos > maxVFTrafficClass {
+		return fmt.Errorf("invalid QoS %d: must be between 0 and %d", qos, maxVFTrafficClass)
+	}
+
+	pfLink, _, err := getVfInfo(pfName, vfID)
+	if err != nil {
+		return err
+	}
+
+	if err := netlinkOps.LinkSetVfVlanQosProto(pfLink, vfID, vlan, qos, vlanProto); err != nil {
+		if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EPROTONOSUPPORT) {
+			return fmt.Errorf("driver of PF %q does not support %s VLAN on VF %d: %w", pfName, proto, vfID, err)
+		}
+		return fmt.Errorf("failed to set %s VLAN %d of VF %d on PF %q: %w", proto, vlan, vfID, pfName, err)
+	}
+	return nil
+}
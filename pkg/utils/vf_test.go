@@ -0,0 +1,622 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Dell Inc, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestGetVFRate(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 3)
+	pf.Vfs[1].MinTxRate = 100
+	pf.Vfs[1].MaxTxRate = 1000
+	// drivers without IFLA_VF_RATE only report the legacy tx rate
+	pf.Vfs[2].TxRate = 500
+	newFakeNetlink(t, pf)
+
+	tests := map[string]struct {
+		pfName  string
+		vfID    int
+		wantMin int
+		wantMax int
+		wantErr bool
+	}{
+		"no limit":       {pfName: "enp59s0f0", vfID: 0},
+		"min and max":    {pfName: "enp59s0f0", vfID: 1, wantMin: 100, wantMax: 1000},
+		"legacy tx rate": {pfName: "enp59s0f0", vfID: 2, wantMax: 500},
+		"missing VF":     {pfName: "enp59s0f0", vfID: 3, wantErr: true},
+		"missing PF":     {pfName: "enp59s0f9", vfID: 0, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotMin, gotMax, err := GetVFRate(tt.pfName, tt.vfID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetVFRate() = %d, %d, want error", gotMin, gotMax)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVFRate() failed: %v", err)
+			}
+			if gotMin != tt.wantMin || gotMax != tt.wantMax {
+				t.Errorf("GetVFRate() = %d, %d, want %d, %d", gotMin, gotMax, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestSetVFRate(t *testing.T) {
+	tests := map[string]struct {
+		minRate    int
+		maxRate    int
+		rateErr    error
+		wantMin    uint32
+		wantMax    uint32
+		wantTxRate int
+		wantErr    bool
+	}{
+		"min and max":       {minRate: 100, maxRate: 1000, wantMin: 100, wantMax: 1000},
+		"max only":          {maxRate: 1000, wantMax: 1000},
+		"min without max":   {minRate: 100, wantMin: 100},
+		"remove limits":     {},
+		"negative min":      {minRate: -1, maxRate: 1000, wantErr: true},
+		"negative max":      {maxRate: -1, wantErr: true},
+		"min above max":     {minRate: 2000, maxRate: 1000, wantErr: true},
+		"legacy driver max": {maxRate: 1000, rateErr: syscall.EOPNOTSUPP, wantTxRate: 1000},
+		"legacy driver min": {minRate: 100, maxRate: 1000, rateErr: syscall.EOPNOTSUPP, wantErr: true},
+		"netlink failure":   {maxRate: 1000, rateErr: syscall.EPERM, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pf := newFakePF("enp59s0f0", 2)
+			nl := newFakeNetlink(t, pf)
+			if tt.rateErr != nil {
+				nl.errs["LinkSetVfRate"] = tt.rateErr
+			}
+
+			err := SetVFRate("enp59s0f0", 1, tt.minRate, tt.maxRate)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SetVFRate() succeeded, want error")
+				}
+				if pf.Vfs[1].MinTxRate != 0 || pf.Vfs[1].MaxTxRate != 0 || pf.Vfs[1].TxRate != 0 {
+					t.Errorf("VF rate changed despite error: %+v", pf.Vfs[1])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetVFRate() failed: %v", err)
+			}
+			vf := pf.Vfs[1]
+			if vf.MinTxRate != tt.wantMin || vf.MaxTxRate != tt.wantMax || vf.TxRate != tt.wantTxRate {
+				t.Errorf("VF rate = min %d max %d tx %d, want min %d max %d tx %d",
+					vf.MinTxRate, vf.MaxTxRate, vf.TxRate, tt.wantMin, tt.wantMax, tt.wantTxRate)
+			}
+		})
+	}
+}
+
+func TestSetVFRateUnsupportedMin(t *testing.T) {
+	nl := newFakeNetlink(t, newFakePF("enp59s0f0", 1))
+	nl.errs["LinkSetVfRate"] = syscall.EOPNOTSUPP
+
+	err := SetVFRate("enp59s0f0", 0, 100, 1000)
+	if !errors.Is(err, syscall.EOPNOTSUPP) {
+		t.Errorf("SetVFRate() error = %v, want %v", err, syscall.EOPNOTSUPP)
+	}
+}
+
+func TestSetVFTrafficClass(t *testing.T) {
+	tests := map[string]struct {
+		vlan      int
+		vlanProto int
+		tc        int
+		qosErr    error
+		wantProto int
+		wantErr   error
+		fail      bool
+	}{
+		"802.1Q VLAN":        {vlan: 100, vlanProto: 0x8100, tc: 5, wantProto: 0x8100},
+		"802.1ad VLAN":       {vlan: 100, vlanProto: 0x88a8, tc: 3, wantProto: 0x88a8},
+		"unreported proto":   {vlan: 100, tc: 7, wantProto: 0x8100},
+		"no VLAN":            {tc: 5, fail: true, wantErr: ErrVFTrafficClassUnsupported},
+		"invalid class":      {vlan: 100, tc: 8, fail: true},
+		"negative class":     {vlan: 100, tc: -1, fail: true},
+		"unsupported driver": {vlan: 100, tc: 5, qosErr: syscall.EOPNOTSUPP, fail: true, wantErr: ErrVFTrafficClassUnsupported},
+		"netlink failure":    {vlan: 100, tc: 5, qosErr: syscall.EPERM, fail: true, wantErr: syscall.EPERM},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pf := newFakePF("enp59s0f0", 2)
+			pf.Vfs[1].Vlan = tt.vlan
+			pf.Vfs[1].VlanProto = tt.vlanProto
+			nl := newFakeNetlink(t, pf)
+			if tt.qosErr != nil {
+				nl.errs["LinkSetVfVlanQosProto"] = tt.qosErr
+			}
+
+			err := SetVFTrafficClass("enp59s0f0", 1, tt.tc)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("SetVFTrafficClass() succeeded, want error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("SetVFTrafficClass() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetVFTrafficClass() failed: %v", err)
+			}
+			vf := pf.Vfs[1]
+			if vf.Vlan != tt.vlan || vf.Qos != tt.tc || vf.VlanProto != tt.wantProto {
+				t.Errorf("VF VLAN = %d qos %d proto %#x, want %d qos %d proto %#x",
+					vf.Vlan, vf.Qos, vf.VlanProto, tt.vlan, tt.tc, tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestResetAllVFs(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 3)
+	for i := range pf.Vfs {
+		pf.Vfs[i].Mac = net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, byte(i)}
+		pf.Vfs[i].Vlan = 100 + i
+		pf.Vfs[i].Qos = 3
+		pf.Vfs[i].Spoofchk = false
+		pf.Vfs[i].Trust = 1
+	}
+	newFakeNetlink(t, pf)
+
+	if err := ResetAllVFs("enp59s0f0"); err != nil {
+		t.Fatalf("ResetAllVFs() failed: %v", err)
+	}
+
+	zeroMac := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	for _, vf := range pf.Vfs {
+		if !bytes.Equal(vf.Mac, zeroMac) || vf.Vlan != 0 || vf.Qos != 0 || !vf.Spoofchk || vf.Trust != 0 {
+			t.Errorf("VF %d not reset: %+v", vf.ID, vf)
+		}
+	}
+}
+
+func TestResetAllVFsBestEffort(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 2)
+	for i := range pf.Vfs {
+		pf.Vfs[i].Vlan = 100
+		pf.Vfs[i].Trust = 1
+	}
+	nl := newFakeNetlink(t, pf)
+	nl.errs["LinkSetVfHardwareAddr"] = syscall.EPERM
+	nl.errs["LinkSetVfSpoofchk"] = syscall.EOPNOTSUPP
+
+	err := ResetAllVFs("enp59s0f0")
+	if err == nil {
+		t.Fatal("ResetAllVFs() succeeded, want error")
+	}
+	for _, want := range []error{syscall.EPERM, syscall.EOPNOTSUPP} {
+		if !errors.Is(err, want) {
+			t.Errorf("ResetAllVFs() error = %v, want it to match %v", err, want)
+		}
+	}
+	// the failing setters do not stop the others
+	for _, vf := range pf.Vfs {
+		if vf.Vlan != 0 || vf.Trust != 0 {
+			t.Errorf("VF %d not reset past the failures: %+v", vf.ID, vf)
+		}
+	}
+}
+
+func TestResetAllVFsMissingPF(t *testing.T) {
+	newFakeNetlink(t)
+
+	if err := ResetAllVFs("enp59s0f0"); err == nil {
+		t.Error("ResetAllVFs() succeeded, want error")
+	}
+}
+
+func TestSetVFMacIfUnset(t *testing.T) {
+	newMac := net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}
+	assignedMac := net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0xff}
+
+	tests := map[string]struct {
+		current     net.HardwareAddr
+		mac         net.HardwareAddr
+		setErr      error
+		wantChanged bool
+		wantMac     net.HardwareAddr
+		wantErr     bool
+	}{
+		"no MAC":          {mac: newMac, wantChanged: true, wantMac: newMac},
+		"zero MAC":        {current: net.HardwareAddr{0, 0, 0, 0, 0, 0}, mac: newMac, wantChanged: true, wantMac: newMac},
+		"MAC assigned":    {current: assignedMac, mac: newMac, wantMac: assignedMac},
+		"same MAC":        {current: newMac, mac: newMac, wantMac: newMac},
+		"invalid MAC":     {mac: net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, wantErr: true},
+		"netlink failure": {mac: newMac, setErr: syscall.EPERM, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pf := newFakePF("enp59s0f0", 2)
+			pf.Vfs[1].Mac = tt.current
+			nl := newFakeNetlink(t, pf)
+			if tt.setErr != nil {
+				nl.errs["LinkSetVfHardwareAddr"] = tt.setErr
+			}
+
+			changed, err := SetVFMacIfUnset("enp59s0f0", 1, tt.mac)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SetVFMacIfUnset() succeeded, want error")
+				}
+				if !bytes.Equal(pf.Vfs[1].Mac, tt.current) {
+					t.Errorf("VF MAC changed to %v despite the error", pf.Vfs[1].Mac)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetVFMacIfUnset() failed: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("SetVFMacIfUnset() = %v, want %v", changed, tt.wantChanged)
+			}
+			if !bytes.Equal(pf.Vfs[1].Mac, tt.wantMac) {
+				t.Errorf("VF MAC = %v, want %v", pf.Vfs[1].Mac, tt.wantMac)
+			}
+		})
+	}
+}
+
+func TestSetVFMacIfUnsetMissingVF(t *testing.T) {
+	newFakeNetlink(t, newFakePF("enp59s0f0", 2))
+
+	if _, err := SetVFMacIfUnset("enp59s0f0", 5, net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}); err == nil {
+		t.Error("SetVFMacIfUnset() succeeded for a missing VF, want error")
+	}
+}
+
+func TestIsMacInUse(t *testing.T) {
+	pf0 := newFakePF("enp59s0f0", 2)
+	pf0.Vfs[0].Mac = net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x00}
+	pf1 := newFakePF("enp94s0f0", 3)
+	pf1.Vfs[2].Mac = net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0xef}
+	plain := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eno1", HardwareAddr: net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01}}}
+
+	tests := map[string]struct {
+		mac        string
+		wantInUse  bool
+		wantDevice string
+		wantErr    bool
+	}{
+		"VF of first PF":       {mac: "02:aa:bb:cc:dd:00", wantInUse: true, wantDevice: "enp59s0f0 vf 0"},
+		"upper case colliding": {mac: "02:AA:BB:CC:DD:EF", wantInUse: true, wantDevice: "enp94s0f0 vf 2"},
+		"netdev MAC not a VF":  {mac: "02:aa:bb:cc:dd:01"},
+		"free MAC":             {mac: "02:aa:bb:cc:dd:02"},
+		"invalid MAC":          {mac: "00:00:00:00:00:00", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			newFakeNetlink(t, pf0, pf1, plain)
+			mac, err := net.ParseMAC(tt.mac)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", tt.mac, err)
+			}
+
+			inUse, device, err := IsMacInUse(mac)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("IsMacInUse(%v) = %v, %q, want error", mac, inUse, device)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IsMacInUse(%v) failed: %v", mac, err)
+			}
+			if inUse != tt.wantInUse || device != tt.wantDevice {
+				t.Errorf("IsMacInUse(%v) = %v, %q, want %v, %q", mac, inUse, device, tt.wantInUse, tt.wantDevice)
+			}
+		})
+	}
+}
+
+func TestIsMacInUseLinkListError(t *testing.T) {
+	nl := newFakeNetlink(t)
+	nl.errs["LinkList"] = syscall.EPERM
+
+	if _, _, err := IsMacInUse(net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x00}); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("IsMacInUse() error = %v, want %v", err, syscall.EPERM)
+	}
+}
+
+func TestVFConfigJSON(t *testing.T) {
+	cfg := VFConfig{
+		MAC:       "02:aa:bb:cc:dd:01",
+		Vlan:      100,
+		Qos:       3,
+		VlanProto: 0x88a8,
+		MinTxRate: 100,
+		MaxTxRate: 1000,
+		SpoofChk:  true,
+		Trust:     true,
+		LinkState: netlink.VF_LINK_STATE_ENABLE,
+	}
+
+	// the keys are part of the scratch cache format
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("failed to marshal %+v: %v", cfg, err)
+	}
+	want := `{"mac":"02:aa:bb:cc:dd:01","vlan":100,"qos":3,"vlanProto":34984,` +
+		`"minTxRate":100,"maxTxRate":1000,"spoofchk":true,"trust":true,"linkState":1}`
+	if string(data) != want {
+		t.Errorf("json.Marshal(VFConfig) = %s, want %s", data, want)
+	}
+}
+
+func TestVFConfigRoundTrip(t *testing.T) {
+	src := newFakePF("enp59s0f0", 2)
+	src.Vfs[1] = netlink.VfInfo{
+		ID:        1,
+		Mac:       net.HardwareAddr{0x02, 0xaa, 0xbb, 0xcc, 0xdd, 0x01},
+		Vlan:      100,
+		Qos:       3,
+		VlanProto: int(netlink.VLAN_PROTOCOL_8021AD),
+		MinTxRate: 100,
+		MaxTxRate: 1000,
+		Spoofchk:  false,
+		Trust:     1,
+		LinkState: netlink.VF_LINK_STATE_ENABLE,
+	}
+	newFakeNetlink(t, src)
+
+	cfg, err := SnapshotVFConfig("enp59s0f0", 1)
+	if err != nil {
+		t.Fatalf("SnapshotVFConfig() failed: %v", err)
+	}
+
+	// the snapshot goes through the scratch cache between ADD and DEL
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("failed to marshal %+v: %v", cfg, err)
+	}
+	var cached VFConfig
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", data, err)
+	}
+	if cached != cfg {
+		t.Fatalf("cached config = %+v, want %+v", cached, cfg)
+	}
+
+	dst := newFakePF("enp59s0f0", 2)
+	newFakeNetlink(t, dst)
+	if err := ApplyVFConfig("enp59s0f0", 1, cached); err != nil {
+		t.Fatalf("ApplyVFConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(dst.Vfs[1], src.Vfs[1]) {
+		t.Errorf("restored VF = %+v, want %+v", dst.Vfs[1], src.Vfs[1])
+	}
+	if !reflect.DeepEqual(dst.Vfs[0], newFakePF("enp59s0f0", 1).Vfs[0]) {
+		t.Errorf("other VF changed: %+v", dst.Vfs[0])
+	}
+}
+
+func TestApplyVFConfigDefaultVlanProto(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 1)
+	newFakeNetlink(t, pf)
+
+	// configs cached before VlanProto existed have no protocol
+	if err := ApplyVFConfig("enp59s0f0", 0, VFConfig{Vlan: 100, SpoofChk: true}); err != nil {
+		t.Fatalf("ApplyVFConfig() failed: %v", err)
+	}
+	if got := pf.Vfs[0].VlanProto; got != int(netlink.VLAN_PROTOCOL_8021Q) {
+		t.Errorf("VLAN protocol = %#x, want 802.1Q", got)
+	}
+}
+
+func TestApplyVFConfigBestEffort(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 1)
+	nl := newFakeNetlink(t, pf)
+	nl.errs["LinkSetVfHardwareAddr"] = syscall.EPERM
+	nl.errs["LinkSetVfTrust"] = syscall.EOPNOTSUPP
+
+	cfg := VFConfig{MAC: "02:aa:bb:cc:dd:01", Vlan: 100, Qos: 2, SpoofChk: false, Trust: true, LinkState: netlink.VF_LINK_STATE_DISABLE}
+	err := ApplyVFConfig("enp59s0f0", 0, cfg)
+	if err == nil {
+		t.Fatal("ApplyVFConfig() succeeded, want error")
+	}
+	for _, want := range []error{syscall.EPERM, syscall.EOPNOTSUPP} {
+		if !errors.Is(err, want) {
+			t.Errorf("ApplyVFConfig() error = %v, want it to match %v", err, want)
+		}
+	}
+
+	vf := pf.Vfs[0]
+	if vf.Vlan != 100 || vf.Qos != 2 || vf.Spoofchk || vf.LinkState != netlink.VF_LINK_STATE_DISABLE {
+		t.Errorf("settings after the failures not applied: %+v", vf)
+	}
+}
+
+func TestApplyVFConfigInvalidMAC(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 1)
+	newFakeNetlink(t, pf)
+
+	if err := ApplyVFConfig("enp59s0f0", 0, VFConfig{MAC: "not-a-mac", Vlan: 100}); err == nil {
+		t.Fatal("ApplyVFConfig() succeeded, want error")
+	}
+	if pf.Vfs[0].Vlan != 0 {
+		t.Errorf("VF changed despite the invalid config: %+v", pf.Vfs[0])
+	}
+}
+
+func TestGetVFSpoofCheckAndTrust(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 3)
+	pf.Vfs[1].Spoofchk = false
+	pf.Vfs[2].Trust = 1
+	newFakeNetlink(t, pf)
+
+	tests := map[string]struct {
+		pfName       string
+		vfID         int
+		wantSpoofChk bool
+		wantTrust    bool
+		wantErr      bool
+	}{
+		"driver defaults": {pfName: "enp59s0f0", vfID: 0, wantSpoofChk: true},
+		"spoofcheck off":  {pfName: "enp59s0f0", vfID: 1},
+		"trusted VF":      {pfName: "enp59s0f0", vfID: 2, wantSpoofChk: true, wantTrust: true},
+		"missing VF":      {pfName: "enp59s0f0", vfID: 3, wantErr: true},
+		"missing PF":      {pfName: "enp59s0f1", vfID: 0, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			spoofChk, err := GetVFSpoofCheck(tt.pfName, tt.vfID)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("GetVFSpoofCheck(%q, %d) error = %v, want error %v", tt.pfName, tt.vfID, err, tt.wantErr)
+			}
+			if spoofChk != tt.wantSpoofChk {
+				t.Errorf("GetVFSpoofCheck(%q, %d) = %v, want %v", tt.pfName, tt.vfID, spoofChk, tt.wantSpoofChk)
+			}
+
+			trust, err := GetVFTrust(tt.pfName, tt.vfID)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("GetVFTrust(%q, %d) error = %v, want error %v", tt.pfName, tt.vfID, err, tt.wantErr)
+			}
+			if trust != tt.wantTrust {
+				t.Errorf("GetVFTrust(%q, %d) = %v, want %v", tt.pfName, tt.vfID, trust, tt.wantTrust)
+			}
+		})
+	}
+}
+
+func TestGetVFSpoofCheckReflectsSetter(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 1)
+	newFakeNetlink(t, pf)
+
+	if err := ApplyVFConfig("enp59s0f0", 0, VFConfig{SpoofChk: false, Trust: true}); err != nil {
+		t.Fatalf("ApplyVFConfig() failed: %v", err)
+	}
+	if spoofChk, err := GetVFSpoofCheck("enp59s0f0", 0); err != nil || spoofChk {
+		t.Errorf("GetVFSpoofCheck() = %v, %v, want false after reconciling", spoofChk, err)
+	}
+	if trust, err := GetVFTrust("enp59s0f0", 0); err != nil || !trust {
+		t.Errorf("GetVFTrust() = %v, %v, want true after reconciling", trust, err)
+	}
+}
+
+func TestGetVFVlan(t *testing.T) {
+	pf := newFakePF("enp59s0f0", 3)
+	pf.Vfs[1].Vlan = 100
+	pf.Vfs[2].Vlan = 4094
+	pf.Vfs[2].Qos = 7
+	newFakeNetlink(t, pf)
+
+	tests := map[string]struct {
+		pfName   string
+		vfID     int
+		wantVlan int
+		wantQos  int
+		wantErr  bool
+	}{
+		"untagged VF":       {pfName: "enp59s0f0", vfID: 0},
+		"tagged VF":         {pfName: "enp59s0f0", vfID: 1, wantVlan: 100},
+		"tagged VF and QoS": {pfName: "enp59s0f0", vfID: 2, wantVlan: 4094, wantQos: 7},
+		"missing VF":        {pfName: "enp59s0f0", vfID: 3, wantErr: true},
+		"missing PF":        {pfName: "enp59s0f1", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			vlan, qos, err := GetVFVlan(tt.pfName, tt.vfID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetVFVlan(%q, %d) = %d, %d, want error", tt.pfName, tt.vfID, vlan, qos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetVFVlan(%q, %d) failed: %v", tt.pfName, tt.vfID, err)
+			}
+			if vlan != tt.wantVlan || qos != tt.wantQos {
+				t.Errorf("GetVFVlan(%q, %d) = %d, %d, want %d, %d", tt.pfName, tt.vfID, vlan, qos, tt.wantVlan, tt.wantQos)
+			}
+		})
+	}
+}
+
+func TestSetVFVlanProto(t *testing.T) {
+	tests := map[string]struct {
+		vlan      int
+		qos       int
+		proto     string
+		nlErr     error
+		wantProto int
+		wantErr   bool
+	}{
+		"802.1Q":              {vlan: 100, qos: 3, proto: "802.1Q", wantProto: int(netlink.VLAN_PROTOCOL_8021Q)},
+		"802.1ad":             {vlan: 200, proto: "802.1ad", wantProto: int(netlink.VLAN_PROTOCOL_8021AD)},
+		"lower case proto":    {vlan: 100, proto: "802.1q", wantErr: true},
+		"unknown proto":       {vlan: 100, proto: "802.1x", wantErr: true},
+		"empty proto":         {vlan: 100, wantErr: true},
+		"VLAN out of range":   {vlan: 4096, proto: "802.1Q", wantErr: true},
+		"QoS out of range":    {vlan: 100, qos: 8, proto: "802.1Q", wantErr: true},
+		"driver without QinQ": {vlan: 200, proto: "802.1ad", nlErr: syscall.EPROTONOSUPPORT, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pf := newFakePF("enp59s0f0", 2)
+			nl := newFakeNetlink(t, pf)
+			if tt.nlErr != nil {
+				nl.errs["LinkSetVfVlanQosProto"] = tt.nlErr
+			}
+
+			err := SetVFVlanProto("enp59s0f0", 1, tt.vlan, tt.qos, tt.proto)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SetVFVlanProto(%d, %d, %q) succeeded, want error", tt.vlan, tt.qos, tt.proto)
+				}
+				if tt.nlErr != nil && !errors.Is(err, tt.nlErr) {
+					t.Errorf("SetVFVlanProto() error = %v, want %v", err, tt.nlErr)
+				}
+				if pf.Vfs[1].Vlan != 0 {
+					t.Errorf("VF changed despite the error: %+v", pf.Vfs[1])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetVFVlanProto(%d, %d, %q) failed: %v", tt.vlan, tt.qos, tt.proto, err)
+			}
+			vf := pf.Vfs[1]
+			if vf.Vlan != tt.vlan || vf.Qos != tt.qos || vf.VlanProto != tt.wantProto {
+				t.Errorf("VF VLAN = %d, QoS = %d, proto = %#x, want %d, %d, %#x", vf.Vlan, vf.Qos, vf.VlanProto, tt.vlan, tt.qos, tt.wantProto)
+			}
+			if pf.Vfs[0].Vlan != 0 {
+				t.Errorf("other VF changed: %+v", pf.Vfs[0])
+			}
+		})
+	}
+}
+
+func TestSetVFVlanProtoMissingVF(t *testing.T) {
+	newFakeNetlink(t, newFakePF("enp59s0f0", 1))
+
+	if err := SetVFVlanProto("enp59s0f0", 1, 100, 0, "802.1Q"); err == nil {
+		t.Error("SetVFVlanProto() succeeded for a missing VF, want error")
+	}
+}